@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/mail"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+// maxTokenLength bounds tokens read from requests; issued ones are 43 characters
+const maxTokenLength = 128
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+type AccountStatusResponse struct {
+	Status string `json:"status"`
+}
+
+func (r VerifyEmailRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("token", r.Token)
+	v.Length("token", r.Token, 1, maxTokenLength)
+	return v.Errors()
+}
+
+func (r ChangePasswordRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("currentPassword", r.CurrentPassword)
+	v.Required("newPassword", r.NewPassword)
+	v.Password("newPassword", r.NewPassword)
+	v.Check(r.NewPassword != r.CurrentPassword, "newPassword", "must differ from the current password")
+	return v.Errors()
+}
+
+func (r PasswordResetRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("email", r.Email)
+	v.Email("email", r.Email)
+	return v.Errors()
+}
+
+func (r ResetPasswordRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("token", r.Token)
+	v.Length("token", r.Token, 1, maxTokenLength)
+	v.Required("newPassword", r.NewPassword)
+	v.Password("newPassword", r.NewPassword)
+	return v.Errors()
+}
+
+// accountFlows issues the one-time tokens behind email verification and
+// password resets and emails them to users
+type accountFlows struct {
+	cfg     config.Account
+	mailer  mail.Mailer
+	workers *backgroundWorkers
+}
+
+func newAccountFlows(cfg config.Account, mailer mail.Mailer, workers *backgroundWorkers) *accountFlows {
+	return &accountFlows{cfg: cfg, mailer: mailer, workers: workers}
+}
+
+// newAccountToken returns a random token for the user and the hash we store;
+// a leaked database doesn't leak usable tokens
+func newAccountToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashAccountToken(token)
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendVerification emails user a link that verifies their address
+func (a *accountFlows) sendVerification(ctx context.Context, client graphdb.GraphDbClient, user graphdb.AuthUser) error {
+	link, err := a.issue(client, user.ID, graphdb.TokenEmailVerification, a.cfg.VerificationTTL, "/verify-email")
+	if err != nil {
+		return err
+	}
+	a.send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link within %s:\n\n%s\n\n"+
+			"If you didn't create an account, you can ignore this email.\n",
+			user.Username, formatTTL(a.cfg.VerificationTTL), link),
+	})
+	return nil
+}
+
+// sendPasswordReset emails user a link for choosing a new password
+func (a *accountFlows) sendPasswordReset(ctx context.Context, client graphdb.GraphDbClient, user graphdb.AuthUser) error {
+	link, err := a.issue(client, user.ID, graphdb.TokenPasswordReset, a.cfg.ResetTTL, "/reset-password")
+	if err != nil {
+		return err
+	}
+	a.send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nYou can choose a new password by opening this link within %s:\n\n%s\n\n"+
+			"If you didn't ask to reset your password, you can ignore this email; your password won't change.\n",
+			user.Username, formatTTL(a.cfg.ResetTTL), link),
+	})
+	return nil
+}
+
+// issue stores a new token and returns the frontend link carrying it
+func (a *accountFlows) issue(client graphdb.GraphDbClient, userId, purpose string, ttl time.Duration, path string) (string, error) {
+	token, hash := newAccountToken()
+	if err := client.CreateAccountToken(userId, purpose, hash, ttl); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(a.cfg.AppURL, "/") + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// send delivers msg in the background so slow mail servers don't hold up
+// the request, and so response times don't reveal whether an email exists
+func (a *accountFlows) send(ctx context.Context, msg mail.Message) {
+	a.workers.Go(ctx, func(ctx context.Context) {
+		if err := a.mailer.Send(ctx, msg); err != nil {
+			loggerFrom(ctx).Error("failed to send email", "subject", msg.Subject, "err", err)
+		}
+	})
+}
+
+// formatTTL renders a token lifetime for email text, e.g. "48 hours"
+func formatTTL(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d >= time.Minute:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// handleVerifyEmail marks the address of the token's user as verified
+func handleVerifyEmail(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+		userId, err := client.ConsumeAccountToken(graphdb.TokenEmailVerification, hashAccountToken(req.Token))
+		if err != nil {
+			logger.Error("failed to consume verification token", "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if userId == "" {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		if err := client.MarkEmailVerified(userId); err != nil {
+			logger.Error("failed to mark email verified", "user_id", userId, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AccountStatusResponse{Status: "verified"})
+	}
+}
+
+// handleResendVerification sends the caller a new verification link
+func handleResendVerification(client graphdb.GraphDbClient, accounts *accountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userId, err := authenticatedUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+		user, err := client.GetUserById(userId)
+		if err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to get user", "user_id", userId, "err", err)
+			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+			return
+		}
+		if user.EmailVerified {
+			http.Error(w, "Email already verified", http.StatusConflict)
+			return
+		}
+		if err := accounts.sendVerification(r.Context(), client, user); err != nil {
+			logger.Error("failed to issue verification token", "user_id", userId, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(AccountStatusResponse{Status: "sent"})
+	}
+}
+
+// handleChangePassword changes the caller's password after checking the
+// current one
+func handleChangePassword(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userId, err := authenticatedUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var req ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+		user, err := client.GetUserById(userId)
+		if err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to get user", "user_id", userId, "err", err)
+			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+			return
+		}
+		if _, err := client.ValidateUserCredentials(user.Email, req.CurrentPassword); err != nil {
+			writeValidationErrors(w, validation.Errors{{Field: "currentPassword", Message: "is incorrect"}})
+			return
+		}
+		if err := client.UpdatePassword(userId, req.NewPassword); err != nil {
+			logger.Error("failed to update password", "user_id", userId, "err", err)
+			http.Error(w, "Failed to update password", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleRequestPasswordReset emails a reset link if the address belongs to
+// an account. It answers the same either way so it can't be used to probe
+// for registered addresses.
+func handleRequestPasswordReset(client graphdb.GraphDbClient, accounts *accountFlows) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		if user, err := client.GetUserByEmail(req.Email); err == nil {
+			if err := accounts.sendPasswordReset(r.Context(), client, user); err != nil {
+				loggerFrom(r.Context()).Error("failed to issue password reset token", "user_id", user.ID, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(AccountStatusResponse{Status: "sent"})
+	}
+}
+
+// handleResetPassword sets a new password using an emailed reset token
+func handleResetPassword(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+		userId, err := client.ConsumeAccountToken(graphdb.TokenPasswordReset, hashAccountToken(req.Token))
+		if err != nil {
+			logger.Error("failed to consume password reset token", "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if userId == "" {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		if err := client.UpdatePassword(userId, req.NewPassword); err != nil {
+			logger.Error("failed to update password", "user_id", userId, "err", err)
+			http.Error(w, "Failed to update password", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleDeleteUser deletes the caller's account. By default their posts and
+// replies stay up under an anonymized user; ?purge=true deletes them too.
+func handleDeleteUser(client graphdb.GraphDbClient, avatars *avatarUploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] != "users" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+		v := validation.New()
+		v.UUID("userId", userId)
+		purge := v.Bool("purge", r.URL.Query().Get("purge"))
+		if errs := v.Errors(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+		avatarKey, err := client.DeleteUser(userId, purge)
+		if err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to delete user", "user_id", userId, "err", err)
+			http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+			return
+		}
+		avatars.delete(r.Context(), avatarKey)
+		logger.Info("account deleted", "user_id", userId, "purge", purge)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
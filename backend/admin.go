@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/taxonomy"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+type EmotionMergeRequest struct {
+	From []string `json:"from"`
+	Into string   `json:"into"`
+}
+
+type EmotionMergeResponse struct {
+	Into     string   `json:"into"`
+	Merged   []string `json:"merged"`
+	Retagged int      `json:"retagged"`
+}
+
+func (r EmotionMergeRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("into", r.Into)
+	_, ok := taxonomy.Lookup(r.Into)
+	v.Check(ok, "into", "must be a canonical emotion")
+	v.Check(len(r.From) > 0, "from", "is required")
+	for _, from := range r.From {
+		v.Check(from != "", "from", "must not contain empty names")
+		// Merged nodes are deleted, and with them the filters pointing at
+		// them; only fragments outside the taxonomy may be folded in
+		_, canonical := taxonomy.Lookup(from)
+		v.Check(!canonical, "from", "must not contain canonical emotions")
+	}
+	return v.Errors()
+}
+
+// handleMergeEmotions folds fragmented Emotion nodes (e.g. happiness, happy)
+// into a canonical one, moving their tags
+func handleMergeEmotions(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req EmotionMergeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		retagged, err := client.MergeEmotions(req.From, req.Into)
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to merge emotions", "from", req.From, "into", req.Into, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		loggerFrom(r.Context()).Info("emotions merged", "from", req.From, "into", req.Into, "retagged", retagged)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EmotionMergeResponse{
+			Into:     req.Into,
+			Merged:   req.From,
+			Retagged: retagged,
+		})
+	}
+}
+
+type EmotionCorrectionsResponse struct {
+	Corrections []graphdb.EmotionCorrection `json:"corrections"`
+	// Next is the since value for the following page, empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// handleExportEmotionCorrections exports author corrections alongside the
+// model's output as a labeled dataset for retraining the analyzer
+func handleExportEmotionCorrections(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		v := validation.New()
+		since := q.Get("since")
+		if since != "" {
+			t, err := time.Parse(time.RFC3339, since)
+			v.Check(err == nil, "since", "must be an RFC 3339 timestamp")
+			since = t.UTC().Format(time.RFC3339)
+		}
+		limit := v.IntRange("limit", q.Get("limit"), 1, 1000, 100)
+		if errs := v.Errors(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		corrections, err := client.GetEmotionCorrections(since, limit)
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to export emotion corrections", "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := EmotionCorrectionsResponse{Corrections: corrections}
+		if len(corrections) == limit {
+			// Timestamps have second precision, so the last second may be
+			// returned again on the next page; consumers dedupe by postId
+			resp.Next = corrections[len(corrections)-1].CorrectedAt
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+type PhantomUsersResponse struct {
+	Users []graphdb.PhantomUser `json:"users"`
+}
+
+// handlePhantomUsers reports the empty User nodes that writes used to MERGE
+// into existence for unknown user IDs. Removing them is left to the
+// cleanup-phantom-users command, so it can't be done by a stray request.
+func handlePhantomUsers(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		users, err := client.FindPhantomUsers()
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to find phantom users", "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PhantomUsersResponse{Users: users})
+	}
+}
+
+// runPhantomUserCleanup is the cleanup-phantom-users command. It lists the
+// phantom users and what is attached to them, and only deletes them when
+// -delete is given. Server flags such as -config follow a "--".
+func runPhantomUserCleanup(args []string) int {
+	fs := flag.NewFlagSet("cleanup-phantom-users", flag.ContinueOnError)
+	deleteUsers := fs.Bool("delete", false, "delete the phantom users instead of only listing them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := config.Load(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		return 2
+	}
+
+	client, err := graphdb.NewNeo4jClient(cfg.Neo4j)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create Neo4j client:", err)
+		return 1
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.VerifyConnectivity(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to connect to Neo4j:", err)
+		return 1
+	}
+
+	users, err := client.FindPhantomUsers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to find phantom users:", err)
+		return 1
+	}
+	for _, u := range users {
+		fmt.Printf("%s\tposts=%d replies=%d reactions=%d follows=%d\n", u.ID, u.Posts, u.Replies, u.Reactions, u.Follows)
+	}
+	if !*deleteUsers {
+		fmt.Printf("%d phantom users found; run again with -delete to remove them\n", len(users))
+		return 0
+	}
+
+	removed, err := client.DeletePhantomUsers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to delete phantom users:", err)
+		return 1
+	}
+	fmt.Printf("%d phantom users removed\n", removed)
+	return 0
+}
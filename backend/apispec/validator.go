@@ -0,0 +1,137 @@
+package apispec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// Validator checks requests and responses against openapi/openapi.yaml.
+// It is meant for development: requests that violate the spec are rejected
+// with 400, responses that violate it are logged but still sent.
+type Validator struct {
+	router routers.Router
+
+	// Logger returns the logger for a request; defaults to slog.Default.
+	Logger func(ctx context.Context) *slog.Logger
+}
+
+// Load reads and validates the spec at path and builds a router for it.
+func Load(path string) (*Validator, error) {
+	// Keep validation errors to one line instead of dumping the whole schema
+	openapi3.SchemaErrorDetailsDisabled = true
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load spec: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	// The documented server URL is the production host; match any host so
+	// the spec can be applied to local and in-process servers.
+	doc.Servers = nil
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("build router: %w", err)
+	}
+	return &Validator{
+		router: router,
+		Logger: func(context.Context) *slog.Logger { return slog.Default() },
+	}, nil
+}
+
+// Middleware validates every documented operation passing through next.
+// Undocumented routes are logged and passed through untouched.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			v.Logger(r.Context()).Warn("openapi: undocumented route", "method", r.Method, "path", r.URL.Path, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqInput := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), reqInput); err != nil {
+			if fe, ok := fieldError(err); ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(map[string]any{"errors": validation.Errors{fe}})
+				return
+			}
+			http.Error(w, "Request does not match API spec: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		respInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: reqInput,
+			Status:                 rec.status,
+			Header:                 rec.Header(),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		}
+		respInput.SetBodyBytes(rec.body.Bytes())
+		if err := openapi3filter.ValidateResponse(context.Background(), respInput); err != nil {
+			v.Logger(r.Context()).Warn("openapi: response does not match spec", "method", r.Method, "path", r.URL.Path, "status", rec.status, "err", err)
+		}
+	})
+}
+
+// fieldError maps a schema or parameter violation to the same field error
+// shape the handlers return, so development and production agree on 422s.
+func fieldError(err error) (validation.FieldError, bool) {
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		field := strings.Join(schemaErr.JSONPointer(), ".")
+		if field == "" {
+			var reqErr *openapi3filter.RequestError
+			if errors.As(err, &reqErr) && reqErr.Parameter != nil {
+				field = reqErr.Parameter.Name
+			}
+		}
+		return validation.FieldError{Field: field, Message: schemaErr.Reason}, field != ""
+	}
+	return validation.FieldError{}, false
+}
+
+// recorder passes the response through while keeping a copy of the status
+// and body for validation.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,47 @@
+// Package blob stores uploaded files such as avatars on local disk or in an
+// S3-compatible bucket.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+)
+
+// Store saves files under slash-separated keys, e.g. avatars/<userId>/<id>.jpg
+type Store interface {
+	// Put stores data under key and returns the URL clients fetch it from
+	Put(ctx context.Context, key, contentType string, data []byte) (url string, err error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+var errInvalidKey = errors.New("blob: invalid key")
+
+// New returns the store selected by cfg.Backend
+func New(cfg config.Blob) (Store, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.Local.Dir, cfg.Local.URLPrefix)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("blob: unknown backend %q", cfg.Backend)
+	}
+}
+
+// validKey rejects keys that could escape the store's root
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+type UserRelationResponse struct {
+	Status string `json:"status"`
+}
+
+// userRelation is a one-way relation users keep to protect themselves from
+// someone: blocks and mutes. Both are private to the user who created them.
+type userRelation struct {
+	segment string // path segment under /users/{userId}
+	added   string // status after adding, e.g. "blocked"
+	removed string
+
+	add    func(userId, targetUserId string) error
+	remove func(userId, targetUserId string) error
+	list   func(userId string) ([]graphdb.UserSummary, error)
+}
+
+func blockRelation(client graphdb.GraphDbClient) userRelation {
+	return userRelation{
+		segment: "blocks",
+		added:   "blocked",
+		removed: "unblocked",
+		add:     client.BlockUser,
+		remove:  client.UnblockUser,
+		list:    client.GetBlockedUsers,
+	}
+}
+
+func muteRelation(client graphdb.GraphDbClient) userRelation {
+	return userRelation{
+		segment: "mutes",
+		added:   "muted",
+		removed: "unmuted",
+		add:     client.MuteUser,
+		remove:  client.UnmuteUser,
+		list:    client.GetMutedUsers,
+	}
+}
+
+// handleUserRelation serves GET and POST /users/{userId}/{segment} and
+// DELETE /users/{userId}/{segment}/{targetUserId}
+func handleUserRelation(rel userRelation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] != "users" || parts[2] != rel.segment {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+
+		allowed := r.Method == http.MethodGet || r.Method == http.MethodPost
+		if len(parts) == 4 {
+			allowed = r.Method == http.MethodDelete
+		}
+		if !allowed {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+		logger := loggerFrom(r.Context())
+
+		switch r.Method {
+		case http.MethodGet:
+			users, err := rel.list(userId)
+			if err != nil {
+				logger.Error("failed to list users", "relation", rel.segment, "user_id", userId, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(UsersResponse{Users: users})
+		case http.MethodPost:
+			var req FollowRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			errs := req.Validate()
+			if errs == nil && req.TargetUserID == userId {
+				errs = validation.Errors{{Field: "targetUserId", Message: "must not be yourself"}}
+			}
+			if errs != nil {
+				writeValidationErrors(w, errs)
+				return
+			}
+
+			if err := rel.add(userId, req.TargetUserID); err != nil {
+				if writeIfNotFound(w, err) {
+					return
+				}
+				logger.Error("failed to add user relation", "relation", rel.segment, "user_id", userId, "target_user_id", req.TargetUserID, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(UserRelationResponse{Status: rel.added})
+		case http.MethodDelete:
+			targetUserId := parts[3]
+			if errs := validatePathIDs("targetUserId", targetUserId); errs != nil {
+				writeValidationErrors(w, errs)
+				return
+			}
+
+			if err := rel.remove(userId, targetUserId); err != nil {
+				logger.Error("failed to remove user relation", "relation", rel.segment, "user_id", userId, "target_user_id", targetUserId, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(UserRelationResponse{Status: rel.removed})
+		}
+	}
+}
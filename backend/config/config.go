@@ -0,0 +1,466 @@
+// Package config loads the backend configuration from defaults, an optional
+// YAML file, environment variables and command-line flags, in that order of
+// precedence (later sources win).
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// DefaultJWTSecret is only acceptable outside production
+	DefaultJWTSecret = "default_secret_key_for_development"
+)
+
+type Config struct {
+	Env             string        `yaml:"env"`
+	ListenAddr      string        `yaml:"listenAddr"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	JWTSecret       string        `yaml:"jwtSecret"`
+
+	// AdminToken guards the /admin endpoints, which are disabled when empty
+	AdminToken string `yaml:"adminToken"`
+
+	// OpenAPISpec is the spec used to validate traffic in development
+	OpenAPISpec string `yaml:"openapiSpec"`
+
+	Log       Log       `yaml:"log"`
+	Neo4j     Neo4j     `yaml:"neo4j"`
+	Emotion   Emotion   `yaml:"emotion"`
+	RateLimit RateLimit `yaml:"rateLimit"`
+	Blob      Blob      `yaml:"blob"`
+	Avatar    Avatar    `yaml:"avatar"`
+	Account   Account   `yaml:"account"`
+	Mail      Mail      `yaml:"mail"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"`  // debug, info, warn, error
+	Format string `yaml:"format"` // json or text
+}
+
+type Neo4j struct {
+	URI      string `yaml:"uri"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type Emotion struct {
+	// BaseURL of the emotion analysis service, e.g. http://emotion_analysis:5000
+	BaseURL string `yaml:"baseUrl"`
+	// Timeout applies to each attempt, not to the call including retries
+	Timeout time.Duration  `yaml:"timeout"`
+	Retry   EmotionRetry   `yaml:"retry"`
+	Breaker EmotionBreaker `yaml:"breaker"`
+	Cache   EmotionCache   `yaml:"cache"`
+	Ingest  EmotionIngest  `yaml:"ingest"`
+}
+
+// EmotionIngest decides which analyzed emotions are stored as tags. The
+// analyzer's unfiltered output is stored alongside for auditing.
+type EmotionIngest struct {
+	MinScore float64 `yaml:"minScore"` // drop emotions scoring below this
+	MaxTags  int     `yaml:"maxTags"`  // keep at most this many, 0 for no limit
+	// Renormalize rescales the kept scores so they sum to 1
+	Renormalize bool `yaml:"renormalize"`
+}
+
+// EmotionRetry controls retries of failed calls with jittered exponential backoff
+type EmotionRetry struct {
+	MaxRetries int           `yaml:"maxRetries"`
+	BaseDelay  time.Duration `yaml:"baseDelay"`
+	MaxDelay   time.Duration `yaml:"maxDelay"`
+}
+
+// EmotionBreaker opens the circuit after Threshold consecutive failures and
+// stops calling the service for Cooldown. A threshold of 0 disables it.
+type EmotionBreaker struct {
+	Threshold int           `yaml:"threshold"`
+	Cooldown  time.Duration `yaml:"cooldown"`
+}
+
+// EmotionCache caches analysis results by content hash so identical content
+// is only sent to the LLM once
+type EmotionCache struct {
+	Enabled bool          `yaml:"enabled"`
+	Size    int           `yaml:"size"` // in-memory entries
+	TTL     time.Duration `yaml:"ttl"`
+	// Persistent also stores results in Neo4j so they survive restarts and
+	// are shared between instances
+	Persistent bool `yaml:"persistent"`
+}
+
+// Blob selects where uploaded files such as avatars are stored
+type Blob struct {
+	Backend string    `yaml:"backend"` // local or s3
+	Local   BlobLocal `yaml:"local"`
+	S3      BlobS3    `yaml:"s3"`
+}
+
+// BlobLocal stores files on disk and serves them from the backend itself
+type BlobLocal struct {
+	Dir string `yaml:"dir"`
+	// URLPrefix is the path the files are served under, e.g. /media/
+	URLPrefix string `yaml:"urlPrefix"`
+}
+
+// BlobS3 stores files in a bucket of any S3-compatible service (AWS S3,
+// MinIO, Cloudflare R2, ...) using path-style URLs
+type BlobS3 struct {
+	Endpoint        string `yaml:"endpoint"` // e.g. https://s3.ap-northeast-1.amazonaws.com
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	// PublicURL is where clients fetch objects from, e.g. a CDN in front of
+	// the bucket. Defaults to the bucket URL.
+	PublicURL string `yaml:"publicUrl"`
+}
+
+// Avatar limits uploads and sets the size avatars are stored at
+type Avatar struct {
+	MaxBytes int64 `yaml:"maxBytes"`
+	Size     int   `yaml:"size"` // width and height in pixels
+}
+
+// Account configures email verification and password resets
+type Account struct {
+	// AppURL is the frontend's base URL, used for links in emails
+	AppURL          string        `yaml:"appUrl"`
+	VerificationTTL time.Duration `yaml:"verificationTtl"`
+	ResetTTL        time.Duration `yaml:"resetTtl"`
+	// RequireVerifiedEmail refuses logins until the email address is verified
+	RequireVerifiedEmail bool `yaml:"requireVerifiedEmail"`
+}
+
+type Mail struct {
+	Backend string `yaml:"backend"` // log or smtp
+	From    string `yaml:"from"`    // e.g. "iFeel <no-reply@example.com>"
+	SMTP    SMTP   `yaml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"` // empty disables authentication
+	Password string `yaml:"password"`
+}
+
+type RateLimit struct {
+	Enabled bool `yaml:"enabled"`
+
+	// TrustForwardedFor keys clients by the first X-Forwarded-For address
+	// instead of the connection address; only enable behind a trusted proxy.
+	TrustForwardedFor bool `yaml:"trustForwardedFor"`
+
+	// Analysis covers writes that call the emotion analysis LLM (posts, replies)
+	Analysis Rate `yaml:"analysis"`
+	// Writes covers cheap writes such as reactions, follows and registration
+	Writes Rate `yaml:"writes"`
+	// Login covers login attempts and the password and email token endpoints
+	Login Rate `yaml:"login"`
+
+	// An account is locked for LockoutDuration after LockoutThreshold failed
+	// logins within LockoutWindow
+	LockoutThreshold int           `yaml:"lockoutThreshold"`
+	LockoutWindow    time.Duration `yaml:"lockoutWindow"`
+	LockoutDuration  time.Duration `yaml:"lockoutDuration"`
+}
+
+// Rate allows Requests per Per interval, with bursts of up to Burst
+type Rate struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+func (r Rate) valid() bool {
+	return r.Requests > 0 && r.Per > 0
+}
+
+func defaults() Config {
+	return Config{
+		Env:             EnvDevelopment,
+		ListenAddr:      ":8080",
+		ShutdownTimeout: 20 * time.Second,
+		OpenAPISpec:     "../openapi/openapi.yaml",
+		Log:             Log{Level: "info", Format: "json"},
+		Neo4j:           Neo4j{URI: "bolt://localhost:7687", Username: "neo4j", Password: "password"},
+		Emotion: Emotion{
+			BaseURL: "http://localhost:5001",
+			Timeout: 20 * time.Second,
+			Retry:   EmotionRetry{MaxRetries: 2, BaseDelay: 200 * time.Millisecond, MaxDelay: 2 * time.Second},
+			Breaker: EmotionBreaker{Threshold: 5, Cooldown: 30 * time.Second},
+			Cache:   EmotionCache{Enabled: true, Size: 10000, TTL: 24 * time.Hour},
+			Ingest:  EmotionIngest{MinScore: 0.2, MaxTags: 3},
+		},
+		RateLimit: RateLimit{
+			Enabled:          true,
+			Analysis:         Rate{Requests: 10, Per: time.Minute, Burst: 3},
+			Writes:           Rate{Requests: 60, Per: time.Minute, Burst: 20},
+			Login:            Rate{Requests: 10, Per: time.Minute, Burst: 5},
+			LockoutThreshold: 5,
+			LockoutWindow:    15 * time.Minute,
+			LockoutDuration:  15 * time.Minute,
+		},
+		Blob: Blob{
+			Backend: "local",
+			Local:   BlobLocal{Dir: "data/media", URLPrefix: "/media/"},
+		},
+		Avatar: Avatar{MaxBytes: 5 << 20, Size: 256},
+		Account: Account{
+			AppURL:          "http://localhost:3000",
+			VerificationTTL: 48 * time.Hour,
+			ResetTTL:        time.Hour,
+		},
+		Mail: Mail{
+			Backend: "log",
+			From:    "no-reply@localhost",
+			SMTP:    SMTP{Port: 587},
+		},
+	}
+}
+
+// IsProduction reports whether the server runs with production safeguards
+func (c Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// Load builds the configuration from args (usually os.Args[1:]) and the
+// environment. The YAML file is read from -config or CONFIG_FILE if given.
+func Load(args []string) (Config, error) {
+	cfg := defaults()
+
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	env := fs.String("env", "", "environment: development or production")
+	listenAddr := fs.String("listen", "", "address to listen on, e.g. :8080")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := loadEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	// Flags override everything else, but only when explicitly given
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			cfg.Env = *env
+		case "listen":
+			cfg.ListenAddr = *listenAddr
+		}
+	})
+
+	if cfg.JWTSecret == "" && !cfg.IsProduction() {
+		cfg.JWTSecret = DefaultJWTSecret
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	var errs []error
+	setString := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	setDuration := func(key string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = d
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	setFloat := func(key string, dst *float64) {
+		if v, ok := os.LookupEnv(key); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	setBool := func(key string, dst *bool) {
+		if v, ok := os.LookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	setString("APP_ENV", &cfg.Env)
+	setString("LISTEN_ADDR", &cfg.ListenAddr)
+	setString("JWT_SECRET", &cfg.JWTSecret)
+	setString("ADMIN_TOKEN", &cfg.AdminToken)
+	setString("OPENAPI_SPEC", &cfg.OpenAPISpec)
+	setString("LOG_LEVEL", &cfg.Log.Level)
+	setString("LOG_FORMAT", &cfg.Log.Format)
+	setString("NEO4J_URI", &cfg.Neo4j.URI)
+	setString("NEO4J_USERNAME", &cfg.Neo4j.Username)
+	setString("NEO4J_PASSWORD", &cfg.Neo4j.Password)
+	setString("EMOTION_API", &cfg.Emotion.BaseURL)
+	setDuration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	setDuration("EMOTION_TIMEOUT", &cfg.Emotion.Timeout)
+	setInt("EMOTION_MAX_RETRIES", &cfg.Emotion.Retry.MaxRetries)
+	setInt("EMOTION_BREAKER_THRESHOLD", &cfg.Emotion.Breaker.Threshold)
+	setFloat("EMOTION_MIN_SCORE", &cfg.Emotion.Ingest.MinScore)
+	setInt("EMOTION_MAX_TAGS", &cfg.Emotion.Ingest.MaxTags)
+	setBool("EMOTION_RENORMALIZE", &cfg.Emotion.Ingest.Renormalize)
+	setBool("EMOTION_CACHE_ENABLED", &cfg.Emotion.Cache.Enabled)
+	setBool("EMOTION_CACHE_PERSISTENT", &cfg.Emotion.Cache.Persistent)
+	setDuration("EMOTION_CACHE_TTL", &cfg.Emotion.Cache.TTL)
+	setBool("RATE_LIMIT_ENABLED", &cfg.RateLimit.Enabled)
+	setBool("RATE_LIMIT_TRUST_FORWARDED_FOR", &cfg.RateLimit.TrustForwardedFor)
+	setString("BLOB_BACKEND", &cfg.Blob.Backend)
+	setString("BLOB_DIR", &cfg.Blob.Local.Dir)
+	setString("S3_ENDPOINT", &cfg.Blob.S3.Endpoint)
+	setString("S3_REGION", &cfg.Blob.S3.Region)
+	setString("S3_BUCKET", &cfg.Blob.S3.Bucket)
+	setString("S3_ACCESS_KEY_ID", &cfg.Blob.S3.AccessKeyID)
+	setString("S3_SECRET_ACCESS_KEY", &cfg.Blob.S3.SecretAccessKey)
+	setString("S3_PUBLIC_URL", &cfg.Blob.S3.PublicURL)
+	setString("APP_URL", &cfg.Account.AppURL)
+	setBool("REQUIRE_VERIFIED_EMAIL", &cfg.Account.RequireVerifiedEmail)
+	setString("MAIL_BACKEND", &cfg.Mail.Backend)
+	setString("MAIL_FROM", &cfg.Mail.From)
+	setString("SMTP_HOST", &cfg.Mail.SMTP.Host)
+	setInt("SMTP_PORT", &cfg.Mail.SMTP.Port)
+	setString("SMTP_USERNAME", &cfg.Mail.SMTP.Username)
+	setString("SMTP_PASSWORD", &cfg.Mail.SMTP.Password)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every missing or unsafe value at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == EnvDevelopment || c.Env == EnvProduction, "env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env)
+	check(c.ListenAddr != "", "listen address is required")
+	check(c.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check(c.Neo4j.URI != "", "neo4j uri is required (NEO4J_URI)")
+	check(c.Neo4j.Username != "", "neo4j username is required (NEO4J_USERNAME)")
+	check(c.Emotion.BaseURL != "", "emotion service url is required (EMOTION_API)")
+	check(c.Emotion.Timeout > 0, "emotion timeout must be positive")
+	check(c.Emotion.Retry.MaxRetries >= 0, "emotion max retries must not be negative")
+	if c.Emotion.Retry.MaxRetries > 0 {
+		check(c.Emotion.Retry.BaseDelay > 0 && c.Emotion.Retry.MaxDelay >= c.Emotion.Retry.BaseDelay, "emotion retry delays must be positive with maxDelay >= baseDelay")
+	}
+	check(c.Emotion.Breaker.Threshold >= 0, "emotion breaker threshold must not be negative")
+	if c.Emotion.Breaker.Threshold > 0 {
+		check(c.Emotion.Breaker.Cooldown > 0, "emotion breaker cooldown must be positive")
+	}
+	check(c.Emotion.Ingest.MinScore >= 0 && c.Emotion.Ingest.MinScore <= 1, "emotion min score must be between 0 and 1")
+	check(c.Emotion.Ingest.MaxTags >= 0, "emotion max tags must not be negative")
+	if c.Emotion.Cache.Enabled {
+		check(c.Emotion.Cache.Size > 0, "emotion cache size must be positive")
+		check(c.Emotion.Cache.TTL > 0, "emotion cache ttl must be positive")
+	}
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, c.Log.Level), "log level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log format must be json or text, got %q", c.Log.Format)
+
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.Analysis.valid(), "rate limit analysis needs positive requests and interval")
+		check(c.RateLimit.Writes.valid(), "rate limit writes needs positive requests and interval")
+		check(c.RateLimit.Login.valid(), "rate limit login needs positive requests and interval")
+		check(c.RateLimit.LockoutThreshold > 0, "lockout threshold must be positive")
+		check(c.RateLimit.LockoutWindow > 0 && c.RateLimit.LockoutDuration > 0, "lockout window and duration must be positive")
+	}
+
+	switch c.Blob.Backend {
+	case "local":
+		check(c.Blob.Local.Dir != "", "blob directory is required (BLOB_DIR)")
+		check(strings.HasPrefix(c.Blob.Local.URLPrefix, "/") && strings.HasSuffix(c.Blob.Local.URLPrefix, "/"), "blob url prefix must start and end with /")
+	case "s3":
+		check(c.Blob.S3.Endpoint != "", "s3 endpoint is required (S3_ENDPOINT)")
+		check(c.Blob.S3.Region != "", "s3 region is required (S3_REGION)")
+		check(c.Blob.S3.Bucket != "", "s3 bucket is required (S3_BUCKET)")
+		check(c.Blob.S3.AccessKeyID != "" && c.Blob.S3.SecretAccessKey != "", "s3 credentials are required (S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY)")
+	default:
+		check(false, "blob backend must be local or s3, got %q", c.Blob.Backend)
+	}
+	check(c.Avatar.MaxBytes > 0, "avatar max bytes must be positive")
+	check(c.Avatar.Size >= 32 && c.Avatar.Size <= 1024, "avatar size must be between 32 and 1024 pixels")
+	check(c.Account.AppURL != "", "app url is required for links in emails (APP_URL)")
+	check(c.Account.VerificationTTL > 0 && c.Account.ResetTTL > 0, "account token ttls must be positive")
+	_, err := mail.ParseAddress(c.Mail.From)
+	check(err == nil, "mail from must be an email address (MAIL_FROM), got %q", c.Mail.From)
+	switch c.Mail.Backend {
+	case "log":
+	case "smtp":
+		check(c.Mail.SMTP.Host != "", "smtp host is required (SMTP_HOST)")
+		check(c.Mail.SMTP.Port > 0, "smtp port must be positive")
+	default:
+		check(false, "mail backend must be log or smtp, got %q", c.Mail.Backend)
+	}
+
+	if c.IsProduction() {
+		check(c.JWTSecret != "" && c.JWTSecret != DefaultJWTSecret, "JWT_SECRET must be set to a non-default value in production")
+		check(c.AdminToken == "" || len(c.AdminToken) >= 32, "ADMIN_TOKEN must be at least 32 characters in production")
+		check(c.Neo4j.Password != "", "neo4j password is required in production (NEO4J_PASSWORD)")
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/apispec"
+	"github.com/HarutoKitagawa/emotional_sns/backend/blob"
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/emotion/emotiontest"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/mail"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+const specPath = "../openapi/openapi.yaml"
+
+const (
+	alice   = "00000000-0000-4000-8000-00000000000a"
+	bob     = "00000000-0000-4000-8000-00000000000b"
+	carol   = "00000000-0000-4000-8000-00000000000c"
+	dave    = "00000000-0000-4000-8000-00000000000d"
+	eve     = "00000000-0000-4000-8000-00000000000e"
+	frank   = "00000000-0000-4000-8000-00000000000f"
+	phantom = "00000000-0000-4000-8000-000000000099"
+	missing = "00000000-0000-4000-8000-000000000404"
+
+	bobPublic    = "00000000-0000-4000-9000-0000000000b1"
+	bobFollowers = "00000000-0000-4000-9000-0000000000b2"
+	bobReply     = "00000000-0000-4000-9000-0000000000b3"
+)
+
+// contractCase is one request against the router. Cases run in order and
+// share state, so later cases can rely on what earlier ones created.
+type contractCase struct {
+	method, path string
+	as           string // user ID sent as the bearer token
+	header       map[string]string
+	body         any // encoded as JSON unless it is a multipartBody
+	want         int
+}
+
+// contractHandler serves newRouter against fake, wrapped in the spec
+// validator. Anything the validator would log is collected in warnings.
+func contractHandler(t *testing.T, fake *fakeGraph, emo *emotiontest.Server) (http.Handler, *warnings) {
+	t.Helper()
+	v, err := apispec.Load(specPath)
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	warned := &warnings{}
+	logger := slog.New(warned)
+	v.Logger = func(context.Context) *slog.Logger { return logger }
+
+	store, err := blob.NewLocal(t.TempDir(), "/avatars/")
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	workers := newBackgroundWorkers()
+	t.Cleanup(func() { workers.Shutdown(context.Background()) })
+
+	router := newRouter(
+		fake,
+		newEmotionAPI(config.Emotion{BaseURL: emo.URL, Timeout: time.Second}, fake),
+		workers,
+		nil,
+		newAvatarUploads(store, config.Avatar{MaxBytes: 1 << 20, Size: 64}),
+		newAccountFlows(config.Account{AppURL: "http://localhost", VerificationTTL: time.Hour, ResetTTL: time.Hour}, mail.Log{}, workers),
+		"admin-token",
+	)
+	return v.Middleware(router), warned
+}
+
+// seedContractGraph stores the users and posts the cases refer to: alice
+// follows bob, carol is private, bob has blocked eve, frank has not verified
+// his email yet.
+func seedContractGraph() *fakeGraph {
+	fake := newFakeGraph()
+	fake.addUser(alice, "alice", "password-a", false)
+	fake.addUser(bob, "bob", "password-b", false)
+	fake.addUser(carol, "carol", "password-c", true)
+	fake.addUser(dave, "dave", "password-d", false)
+	fake.addUser(eve, "eve", "password-e", false)
+	fake.addUser(frank, "frank", "password-f", false)
+	fake.users[frank].EmailVerified = false
+	fake.phantoms[phantom] = true
+
+	fake.follows[fakeEdge{alice, bob}] = true
+	fake.blocks[fakeEdge{bob, eve}] = true
+
+	fake.addPost(bobPublic, bob, "今日は楽しかった", "public")
+	fake.addPost(bobFollowers, bob, "フォロワーだけに", "followers")
+	fake.addReply(bobReply, bobPublic, "", bob, "ありがとう")
+
+	fake.tokens[hashAccountToken("verify-token")] = fakeToken{userId: frank, purpose: graphdb.TokenEmailVerification}
+	fake.tokens[hashAccountToken("reset-token")] = fakeToken{userId: dave, purpose: graphdb.TokenPasswordReset}
+	return fake
+}
+
+func TestContract(t *testing.T) {
+	fake := seedContractGraph()
+	emo := emotiontest.NewServer()
+	defer emo.Close()
+	handler, warned := contractHandler(t, fake, emo)
+
+	admin := map[string]string{"X-Admin-Token": "admin-token"}
+	badToken := map[string]string{"Authorization": "Bearer nope"}
+	cases := []contractCase{
+		// Auth
+		{method: "POST", path: "/auth/register", body: map[string]any{"username": "grace", "email": "grace@example.com", "password": "password7"}, want: 201},
+		{method: "POST", path: "/auth/register", body: map[string]any{"username": "alice", "email": "other@example.com", "password": "password7"}, want: 409},
+		{method: "POST", path: "/auth/register", body: map[string]any{"username": "alice2", "email": "alice@example.com", "password": "password7"}, want: 409},
+		{method: "POST", path: "/auth/login", body: map[string]any{"login": "alice", "password": "password-a"}, want: 200},
+		{method: "POST", path: "/auth/login", body: map[string]any{"login": "alice", "password": "wrong-password"}, want: 401},
+		{method: "GET", path: "/auth/me", as: alice, want: 200},
+		{method: "GET", path: "/auth/me", header: badToken, want: 401},
+		{method: "POST", path: "/auth/verify-email/resend", as: frank, want: 202},
+		{method: "POST", path: "/auth/verify-email/resend", as: alice, want: 409},
+		{method: "POST", path: "/auth/verify-email", body: map[string]any{"token": "verify-token"}, want: 200},
+		{method: "POST", path: "/auth/verify-email", body: map[string]any{"token": "verify-token"}, want: 400},
+		{method: "POST", path: "/auth/password/change", as: alice, body: map[string]any{"currentPassword": "password-a", "newPassword": "password2"}, want: 204},
+		{method: "POST", path: "/auth/password/reset/request", body: map[string]any{"email": "dave@example.com"}, want: 202},
+		{method: "POST", path: "/auth/password/reset", body: map[string]any{"token": "reset-token", "newPassword": "password2"}, want: 204},
+
+		// Posts
+		{method: "POST", path: "/posts", body: map[string]any{"userId": alice, "content": "楽しい一日"}, want: 201},
+		{method: "POST", path: "/posts", body: map[string]any{"userId": alice, "content": "これ見て", "quotedPostId": bobPublic}, want: 201},
+		{method: "POST", path: "/posts", body: map[string]any{"userId": alice, "content": "これ見て", "quotedPostId": bobFollowers}, want: 403},
+		{method: "POST", path: "/posts", body: map[string]any{"userId": alice, "content": "これ見て", "quotedPostId": missing}, want: 404},
+		{method: "POST", path: "/posts", body: map[string]any{"userId": alice, "content": ""}, want: 422},
+		{method: "GET", path: "/posts/" + bobPublic, as: alice, want: 200},
+		{method: "GET", path: "/posts/" + missing, want: 404},
+		{method: "POST", path: "/posts/" + bobPublic + "/reactions", body: map[string]any{"userId": alice, "type": "like"}, want: 201},
+		{method: "POST", path: "/posts/" + bobPublic + "/reactions", body: map[string]any{"userId": eve, "type": "like"}, want: 403},
+		{method: "POST", path: "/posts/" + bobPublic + "/reposts", body: map[string]any{"userId": alice}, want: 201},
+		{method: "POST", path: "/posts/" + bobFollowers + "/reposts", body: map[string]any{"userId": alice}, want: 403},
+		{method: "POST", path: "/posts/" + bobPublic + "/replies", body: map[string]any{"userId": alice, "content": "よかったね", "parentReplyId": bobReply}, want: 201},
+		{method: "POST", path: "/posts/" + bobPublic + "/replies", body: map[string]any{"userId": eve, "content": "よかったね"}, want: 403},
+		{method: "GET", path: "/posts/" + bobPublic + "/replies", as: alice, want: 200},
+		{method: "GET", path: "/posts/" + bobFollowers + "/replies", want: 404},
+		{method: "POST", path: "/posts/" + bobPublic + "/replies/" + bobReply + "/reactions", body: map[string]any{"userId": alice, "type": "like"}, want: 201},
+		{method: "POST", path: "/posts/" + bobPublic + "/replies/" + missing + "/reactions", body: map[string]any{"userId": alice, "type": "like"}, want: 404},
+		{method: "PUT", path: "/posts/" + bobPublic + "/emotions", as: bob, body: map[string]any{"emotions": []map[string]any{{"emotion": "sadness", "score": 0.9}}}, want: 200},
+		{method: "PUT", path: "/posts/" + bobPublic + "/emotions", as: alice, body: map[string]any{"emotions": []map[string]any{{"emotion": "sadness", "score": 0.9}}}, want: 403},
+		{method: "PUT", path: "/posts/" + bobPublic + "/emotions", header: badToken, body: map[string]any{"emotions": []map[string]any{{"emotion": "sadness", "score": 0.9}}}, want: 401},
+		{method: "GET", path: "/posts/" + bobPublic + "/influence", as: alice, want: 200},
+
+		// Discovery
+		{method: "GET", path: "/emotion-tags", want: 200},
+		{method: "GET", path: "/emotion-tags?stats=true&sort=usage&limit=5", want: 200},
+		{method: "GET", path: "/search?q=楽しい", as: alice, want: 200},
+		{method: "GET", path: "/users?q=ali", want: 200},
+		{method: "GET", path: "/users/by-username/alice", want: 200},
+		{method: "GET", path: "/users/by-username/nobody", want: 404},
+
+		// Admin
+		{method: "POST", path: "/admin/emotions/merge", header: admin, body: map[string]any{"from": []string{"happy"}, "into": "joy"}, want: 200},
+		{method: "POST", path: "/admin/emotions/merge", header: admin, body: map[string]any{"from": []string{"sadness"}, "into": "joy"}, want: 422},
+		{method: "POST", path: "/admin/emotions/merge", body: map[string]any{"from": []string{"happy"}, "into": "joy"}, want: 401},
+		{method: "GET", path: "/admin/emotion-corrections", header: admin, want: 200},
+		{method: "GET", path: "/admin/phantom-users", header: admin, want: 200},
+
+		// Profiles
+		{method: "GET", path: "/users/" + alice, want: 200},
+		{method: "GET", path: "/users/" + missing, want: 404},
+		{method: "PATCH", path: "/users/" + alice, as: alice, body: map[string]any{"displayName": "Alice", "bio": "こんにちは"}, want: 200},
+		{method: "PATCH", path: "/users/" + alice, as: bob, body: map[string]any{"displayName": "Bob"}, want: 403},
+		{method: "PUT", path: "/users/" + alice + "/avatar", as: alice, body: avatarForm(t), want: 200},
+		{method: "DELETE", path: "/users/" + alice + "/avatar", as: alice, want: 204},
+		{method: "GET", path: "/users/" + alice + "/feed", as: alice, want: 200},
+		{method: "GET", path: "/users/" + alice + "/feed?emotion=joy", as: alice, want: 200},
+		{method: "GET", path: "/users/" + alice + "/feed", as: bob, want: 403},
+		{method: "GET", path: "/users/" + alice + "/feed", header: badToken, want: 401},
+		{method: "GET", path: "/users/" + bob + "/posts", as: alice, want: 200},
+		{method: "GET", path: "/users/" + bob + "/followers", want: 200},
+		{method: "GET", path: "/users/" + alice + "/following", want: 200},
+		{method: "GET", path: "/users/" + alice + "/suggestions?limit=3", want: 200},
+
+		// Follows
+		{method: "POST", path: "/users/" + alice + "/following", body: map[string]any{"targetUserId": dave}, want: 201},
+		{method: "POST", path: "/users/" + alice + "/following", body: map[string]any{"targetUserId": carol}, want: 202},
+		{method: "POST", path: "/users/" + eve + "/following", body: map[string]any{"targetUserId": bob}, want: 403},
+		{method: "POST", path: "/users/" + alice + "/following", body: map[string]any{"targetUserId": missing}, want: 404},
+		{method: "POST", path: "/users/" + dave + "/follow", body: map[string]any{"targetUserId": carol}, want: 202},
+		{method: "POST", path: "/users/" + bob + "/follow", body: map[string]any{"targetUserId": dave}, want: 201},
+		{method: "DELETE", path: "/users/" + alice + "/following/" + dave, want: 200},
+		{method: "GET", path: "/users/" + carol + "/follow-requests", as: carol, want: 200},
+		{method: "GET", path: "/users/" + carol + "/follow-requests", as: alice, want: 403},
+		{method: "POST", path: "/users/" + carol + "/follow-requests/" + alice + "/approve", as: carol, want: 200},
+		{method: "POST", path: "/users/" + carol + "/follow-requests/" + dave + "/deny", as: carol, want: 200},
+		{method: "POST", path: "/users/" + carol + "/follow-requests/" + dave + "/approve", as: carol, want: 404},
+
+		// Blocks, mutes and filters
+		{method: "POST", path: "/users/" + alice + "/blocks", as: alice, body: map[string]any{"targetUserId": eve}, want: 201},
+		{method: "POST", path: "/users/" + alice + "/blocks", as: alice, body: map[string]any{"targetUserId": missing}, want: 404},
+		{method: "GET", path: "/users/" + alice + "/blocks", as: alice, want: 200},
+		{method: "GET", path: "/users/" + alice + "/blocks", as: bob, want: 403},
+		{method: "DELETE", path: "/users/" + alice + "/blocks/" + eve, as: alice, want: 200},
+		{method: "POST", path: "/users/" + alice + "/mutes", as: alice, body: map[string]any{"targetUserId": dave}, want: 201},
+		{method: "GET", path: "/users/" + alice + "/mutes", as: alice, want: 200},
+		{method: "DELETE", path: "/users/" + alice + "/mutes/" + dave, as: alice, want: 200},
+		{method: "PUT", path: "/users/" + alice + "/emotion-filters/anger", as: alice, body: map[string]any{"minScore": 0.5}, want: 200},
+		{method: "PUT", path: "/users/" + alice + "/emotion-filters/anger", as: alice, body: map[string]any{"minScore": 2}, want: 422},
+		{method: "GET", path: "/users/" + alice + "/emotion-filters", as: alice, want: 200},
+		{method: "DELETE", path: "/users/" + alice + "/emotion-filters/anger", as: alice, want: 204},
+
+		// Last, since it removes a user the cases above rely on
+		{method: "DELETE", path: "/users/" + dave, as: alice, want: 403},
+		{method: "DELETE", path: "/users/" + dave + "?purge=true", as: dave, want: 204},
+	}
+
+	succeeded := map[string]bool{}
+	for _, tc := range cases {
+		name := tc.method + " " + tc.path
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, tc.request(t))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d; body: %s", name, rec.Code, tc.want, strings.TrimSpace(rec.Body.String()))
+		}
+		for _, w := range warned.take() {
+			t.Errorf("%s: %s", name, w)
+		}
+		if rec.Code < 300 {
+			succeeded[operationID(t, tc.method, tc.path)] = true
+		}
+	}
+
+	// Only alice's reply is analyzed; eve is refused before the service is called
+	if got := emo.Calls("analyze_reply"); got != 1 {
+		t.Errorf("analyze_reply calls = %d, want 1", got)
+	}
+
+	// A new endpoint in the spec needs a case here too
+	for _, id := range specOperations(t) {
+		if !succeeded[id] {
+			t.Errorf("operation %s has no successful case", id)
+		}
+	}
+}
+
+func (tc contractCase) request(t *testing.T) *http.Request {
+	t.Helper()
+	var body io.Reader
+	contentType := "application/json"
+	switch b := tc.body.(type) {
+	case nil:
+	case multipartBody:
+		body, contentType = bytes.NewReader(b.data), b.contentType
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	r := httptest.NewRequest(tc.method, tc.path, body)
+	if body != nil {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if tc.as != "" {
+		r.Header.Set("Authorization", "Bearer dummy-token-"+tc.as)
+	}
+	for k, v := range tc.header {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+type multipartBody struct {
+	data        []byte
+	contentType string
+}
+
+// avatarForm returns an upload form holding a small PNG
+func avatarForm(t *testing.T) multipartBody {
+	t.Helper()
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	form.Close()
+	return multipartBody{data: buf.Bytes(), contentType: form.FormDataContentType()}
+}
+
+var (
+	specOnce sync.Once
+	specDoc  *openapi3.T
+)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	specOnce.Do(func() {
+		doc, err := openapi3.NewLoader().LoadFromFile(specPath)
+		if err != nil {
+			t.Fatalf("load spec: %v", err)
+		}
+		doc.Servers = nil
+		specDoc = doc
+	})
+	return specDoc
+}
+
+// specOperations lists every operation ID in the spec
+func specOperations(t *testing.T) []string {
+	var ids []string
+	for _, item := range loadSpec(t).Paths.Map() {
+		for _, op := range item.Operations() {
+			ids = append(ids, op.OperationID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// operationID returns the ID of the operation serving method and path
+func operationID(t *testing.T, method, path string) string {
+	t.Helper()
+	router, err := legacy.NewRouter(loadSpec(t))
+	if err != nil {
+		t.Fatalf("build router: %v", err)
+	}
+	route, _, err := router.FindRoute(httptest.NewRequest(method, path, nil))
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return route.Operation.OperationID
+}
+
+// warnings is a slog.Handler keeping every record at warn level or above
+type warnings struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (w *warnings) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+
+func (w *warnings) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteString(" " + a.String())
+		return true
+	})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.records = append(w.records, b.String())
+	return nil
+}
+
+func (w *warnings) WithAttrs([]slog.Attr) slog.Handler { return w }
+func (w *warnings) WithGroup(string) slog.Handler      { return w }
+
+// take returns the records logged since the last call
+func (w *warnings) take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	records := w.records
+	w.records = nil
+	return records
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/taxonomy"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+type EmotionCorrectionRequest struct {
+	Emotions []graphdb.EmotionTag `json:"emotions"`
+}
+
+type EmotionCorrectionResponse struct {
+	PostID      string               `json:"postId"`
+	EmotionTags []graphdb.EmotionTag `json:"emotionTags"`
+}
+
+func (r EmotionCorrectionRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Check(r.Emotions != nil, "emotions", "is required")
+	v.Check(len(r.Emotions) <= validation.MaxEmotionTags, "emotions", "must contain at most "+strconv.Itoa(validation.MaxEmotionTags)+" tags")
+
+	seen := map[string]bool{}
+	for i, e := range r.Emotions {
+		field := "emotions." + strconv.Itoa(i)
+		_, ok := taxonomy.Lookup(e.Type)
+		v.Check(ok, field+".emotion", "must be a canonical emotion")
+		v.Check(!seen[e.Type], field+".emotion", "must not be repeated")
+		v.Check(e.Score > 0 && e.Score <= 1, field+".score", "must be greater than 0 and at most 1")
+		seen[e.Type] = true
+	}
+	return v.Errors()
+}
+
+// handleCorrectPostEmotions lets a post's author replace the tags the
+// analyzer assigned
+func handleCorrectPostEmotions(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		postId := strings.TrimPrefix(r.URL.Path, "/posts/")
+		postId = strings.TrimSuffix(postId, "/emotions")
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		userId, err := authenticatedUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var req EmotionCorrectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+
+		authorId, _, _, _, _, err := client.GetPostWithEmotions(postId, graphdb.Viewer{ID: userId})
+		if err != nil {
+			logger.Error("failed to get post", "post_id", postId, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if authorId == "" {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		if authorId != userId {
+			http.Error(w, "Only the author can correct a post's emotions", http.StatusForbidden)
+			return
+		}
+
+		tags, err := client.CorrectPostEmotions(postId, userId, req.Emotions)
+		if err != nil {
+			logger.Error("failed to correct post emotions", "post_id", postId, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		emotionCorrections.Inc()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EmotionCorrectionResponse{
+			PostID:      postId,
+			EmotionTags: tags,
+		})
+	}
+}
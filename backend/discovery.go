@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+const (
+	maxUserSearchLength = 50
+	// fuzzyMinLength is the shortest term matched with typos; shorter terms
+	// would match almost anything within one edit
+	fuzzyMinLength = 4
+)
+
+type UsersResponse struct {
+	Users []graphdb.UserSummary `json:"users"`
+}
+
+type UserSuggestionsResponse struct {
+	Suggestions []graphdb.UserSuggestion `json:"suggestions"`
+}
+
+// handleSearchUsers finds users by username or display name prefix, allowing
+// small typos in longer terms
+func handleSearchUsers(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		v := validation.New()
+		text := q.Get("q")
+		v.Required("q", text)
+		v.Length("q", text, 1, maxUserSearchLength)
+		limit := v.IntRange("limit", q.Get("limit"), 1, 50, 20)
+		if errs := v.Errors(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		users, err := client.SearchUsers(userSearchQuery(strings.Fields(text)), limit)
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to search users", "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UsersResponse{Users: users})
+	}
+}
+
+// userSearchQuery requires every term to match as a phrase, a prefix or, for
+// longer terms, within one edit. An exact username ranks first.
+func userSearchQuery(terms []string) string {
+	clauses := make([]string, len(terms))
+	for i, term := range terms {
+		// Wildcard and fuzzy terms skip the analyzer, so lowercase them here
+		escaped := luceneEscape(strings.ToLower(term))
+		clause := `username:"` + escaped + `"^4 OR "` + escaped + `"^2 OR ` + escaped + `*`
+		if utf8.RuneCountInString(term) >= fuzzyMinLength {
+			clause += " OR " + escaped + "~1"
+		}
+		clauses[i] = "(" + clause + ")"
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// handleUserSuggestions lists people the user may know
+func handleUserSuggestions(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "users" || parts[2] != "suggestions" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+		v := validation.New()
+		v.UUID("userId", userId)
+		limit := v.IntRange("limit", r.URL.Query().Get("limit"), 1, 50, 10)
+		if errs := v.Errors(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		suggestions, err := client.GetUserSuggestions(userId, limit)
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to get user suggestions", "user_id", userId, "err", err)
+			http.Error(w, "Failed to get suggestions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UserSuggestionsResponse{Suggestions: suggestions})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/emotion"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/taxonomy"
+)
+
+// emotionAPI calls the emotion analysis service through the cache
+type emotionAPI struct {
+	client *emotion.Client
+	cache  *emotionCache // nil when caching is disabled
+	ingest config.EmotionIngest
+}
+
+// newEmotionAPI builds the client; client is only used to persist cached
+// results when the persistent cache is enabled
+func newEmotionAPI(cfg config.Emotion, client graphdb.GraphDbClient) *emotionAPI {
+	c := emotion.New(cfg)
+	c.RequestID = requestIDFrom
+	c.Observe = observeEmotionRequest
+	c.OnBreakerChange(observeEmotionBreaker)
+
+	e := &emotionAPI{client: c, ingest: cfg.Ingest}
+	if cfg.Cache.Enabled {
+		e.cache = newEmotionCache(cfg.Cache, client)
+	}
+	return e
+}
+
+func (e *emotionAPI) analyzeEmotionOfPost(ctx context.Context, content, quoted string) ([]graphdb.EmotionTag, error) {
+	var result []graphdb.EmotionTag
+	key := emotionCacheKey("analyze_post", content)
+	if quoted != "" {
+		key = emotionCacheKey("analyze_post", content, quoted)
+	}
+	err := e.cached(ctx, "analyze_post", key, &result, func() (err error) {
+		result, err = e.client.AnalyzePost(ctx, content, quoted)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *emotionAPI) analyzeEmotionOfReply(ctx context.Context, post string, parents []string, reply string) ([]graphdb.EmotionTag, error) {
+	var result []graphdb.EmotionTag
+	inputs := append(append([]string{post}, parents...), reply)
+	key := emotionCacheKey("analyze_reply", inputs...)
+	err := e.cached(ctx, "analyze_reply", key, &result, func() (err error) {
+		result, err = e.client.AnalyzeReply(ctx, post, parents, reply)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *emotionAPI) analyzeTopicSimilarity(ctx context.Context, content1, content2 string) (bool, error) {
+	// Similarity is symmetric, so order the pair to share one cache entry
+	first, second := normalizeContent(content1), normalizeContent(content2)
+	if first > second {
+		first, second = second, first
+	}
+	key := emotionCacheKey("analyze_topic_similarity", first, second)
+
+	var result emotion.TopicSimilarity
+	err := e.cached(ctx, "analyze_topic_similarity", key, &result, func() (err error) {
+		result, err = e.client.TopicSimilarity(ctx, content1, content2)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// 確信度が0.7以上の場合に同じトピックと判断（閾値は調整可能）
+	return result.IsSameTopic && result.Confidence >= 0.7, nil
+}
+
+// ping checks the service's health endpoint
+func (e *emotionAPI) ping(ctx context.Context) error {
+	return e.client.Ping(ctx)
+}
+
+// cached fills out from the cache under key, or runs fetch to fill it and
+// caches the result. Failed calls are never cached.
+func (e *emotionAPI) cached(ctx context.Context, endpoint, key string, out any, fetch func() error) error {
+	if e.cache == nil {
+		return fetch()
+	}
+	if e.cache.get(ctx, endpoint, key, out) {
+		return nil
+	}
+	if err := fetch(); err != nil {
+		return err
+	}
+	e.cache.put(ctx, endpoint, key, out)
+	return nil
+}
+
+// selectTags turns analyzer output into the tags to store: emotions are
+// mapped onto the canonical taxonomy, then the ingest policy drops low
+// scores, keeps the strongest few and optionally rescales them to sum to 1
+func (e *emotionAPI) selectTags(ctx context.Context, raw []graphdb.EmotionTag) []graphdb.EmotionTag {
+	tags, unknown := taxonomy.Normalize(raw)
+	if len(unknown) > 0 {
+		loggerFrom(ctx).Info("dropped emotions outside the taxonomy", "emotions", unknown)
+	}
+
+	tags = slices.DeleteFunc(tags, func(t graphdb.EmotionTag) bool {
+		return t.Score < e.ingest.MinScore
+	})
+	slices.SortStableFunc(tags, func(a, b graphdb.EmotionTag) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if e.ingest.MaxTags > 0 && len(tags) > e.ingest.MaxTags {
+		tags = tags[:e.ingest.MaxTags]
+	}
+
+	if e.ingest.Renormalize {
+		var sum float64
+		for _, t := range tags {
+			sum += t.Score
+		}
+		if sum > 0 {
+			for i := range tags {
+				tags[i].Score /= sum
+			}
+		}
+	}
+	return tags
+}
+
+// writeEmotionError answers 503 when analysis fails so clients know to retry
+// later; nothing is stored for the request
+func writeEmotionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, emotion.ErrCircuitOpen) {
+		http.Error(w, "Emotion analysis temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Emotion analysis failed", http.StatusServiceUnavailable)
+}
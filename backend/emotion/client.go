@@ -0,0 +1,268 @@
+// Package emotion is the client for the emotion analysis service. Calls are
+// retried with jittered backoff on transport errors, 5xx responses and
+// error payloads, and a circuit breaker stops calling the service while it
+// keeps failing.
+package emotion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+)
+
+// ErrCircuitOpen is returned without calling the service while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("emotion service circuit open")
+
+// StatusError is returned when the service answers with a non-2xx status
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d", e.Endpoint, e.StatusCode)
+}
+
+// ServiceError is returned when the service answers 200 with its error
+// payload, e.g. [{"emotion":"unknown","score":0,"error":"..."}]
+type ServiceError struct {
+	Endpoint string
+	Message  string
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%s: analysis failed: %s", e.Endpoint, e.Message)
+}
+
+// TopicSimilarity is the service's judgement on whether two posts share a topic
+type TopicSimilarity struct {
+	IsSameTopic bool    `json:"is_same_topic"`
+	Confidence  float64 `json:"confidence"`
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      config.EmotionRetry
+	breaker    *breaker
+
+	// RequestID, if set, returns the ID forwarded as X-Request-ID
+	RequestID func(ctx context.Context) string
+	// Observe, if set, is called after every attempt
+	Observe func(endpoint string, duration time.Duration, err error)
+}
+
+func New(cfg config.Emotion) *Client {
+	return &Client{
+		baseURL:    cfg.BaseURL,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		retry:      cfg.Retry,
+		breaker:    newBreaker(cfg.Breaker.Threshold, cfg.Breaker.Cooldown),
+	}
+}
+
+// OnBreakerChange registers fn to be called with the new state ("closed",
+// "open" or "half-open") whenever the circuit breaker changes state
+func (c *Client) OnBreakerChange(fn func(state string)) {
+	c.breaker.onChange = fn
+}
+
+// AnalyzePost analyzes a post, in the context of the post it quotes if
+// quoted isn't empty
+func (c *Client) AnalyzePost(ctx context.Context, content, quoted string) ([]graphdb.EmotionTag, error) {
+	payload := map[string]string{"content": content}
+	if quoted != "" {
+		payload["quoted"] = quoted
+	}
+	return c.analyze(ctx, "analyze_post", payload)
+}
+
+// AnalyzeReply analyzes a reply in the context of the post and, for replies
+// to replies, the chain of replies it answers (oldest first)
+func (c *Client) AnalyzeReply(ctx context.Context, post string, parents []string, reply string) ([]graphdb.EmotionTag, error) {
+	payload := map[string]any{"post": post, "reply": reply}
+	if len(parents) > 0 {
+		payload["parents"] = parents
+	}
+	return c.analyze(ctx, "analyze_reply", payload)
+}
+
+func (c *Client) TopicSimilarity(ctx context.Context, content1, content2 string) (TopicSimilarity, error) {
+	var result struct {
+		TopicSimilarity
+		Error string `json:"error"`
+	}
+	err := c.call(ctx, "analyze_topic_similarity", map[string]string{
+		"post1": content1,
+		"post2": content2,
+	}, &result, func() error {
+		if result.Error != "" {
+			return &ServiceError{Endpoint: "analyze_topic_similarity", Message: result.Error}
+		}
+		return nil
+	})
+	if err != nil {
+		return TopicSimilarity{}, err
+	}
+	return result.TopicSimilarity, nil
+}
+
+// Ping checks the service's health endpoint. It bypasses retries and the
+// circuit breaker so readiness reflects the service's current state.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Endpoint: "health", StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// analyze calls an endpoint answering with a list of emotion tags
+func (c *Client) analyze(ctx context.Context, endpoint string, payload any) ([]graphdb.EmotionTag, error) {
+	var result []struct {
+		graphdb.EmotionTag
+		Error string `json:"error"`
+	}
+	err := c.call(ctx, endpoint, payload, &result, func() error {
+		for _, r := range result {
+			if r.Error != "" {
+				return &ServiceError{Endpoint: endpoint, Message: r.Error}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]graphdb.EmotionTag, len(result))
+	for i, r := range result {
+		tags[i] = r.EmotionTag
+	}
+	return tags, nil
+}
+
+// call posts payload to endpoint and decodes the answer into out, retrying
+// failed attempts. check inspects the decoded answer for an error payload.
+func (c *Client) call(ctx context.Context, endpoint string, payload any, out any, check func() error) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			return ErrCircuitOpen
+		}
+
+		err = c.attempt(ctx, endpoint, body, out)
+		if err == nil {
+			err = check()
+		}
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the service's health
+			c.breaker.abandon()
+			return err
+		}
+		if err != nil && !retryable(err) {
+			// The service answered; the request itself was bad, so one
+			// caller's bad input mustn't open the circuit for everyone
+			c.breaker.abandon()
+			return err
+		}
+		c.breaker.record(err)
+
+		if err == nil || attempt >= c.retry.MaxRetries {
+			return err
+		}
+		if waitErr := sleep(ctx, c.backoff(attempt)); waitErr != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, endpoint string, body []byte, out any) (err error) {
+	start := time.Now()
+	defer func() {
+		if c.Observe != nil {
+			c.Observe(endpoint, time.Since(start), err)
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.RequestID != nil {
+		if id := c.RequestID(ctx); id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, resp.Body)
+		return &StatusError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// retryable reports whether another attempt might succeed: transport
+// errors, 5xx, 429 and error payloads are retried, other 4xx are not
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return false
+	}
+	return true
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retry.BaseDelay << attempt
+	if d <= 0 || d > c.retry.MaxDelay {
+		d = c.retry.MaxDelay
+	}
+	return rand.N(d) + 1
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+package emotion_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/emotion"
+	"github.com/HarutoKitagawa/emotional_sns/backend/emotion/emotiontest"
+)
+
+// newClient returns a client for fake with fast retries and the given
+// breaker settings
+func newClient(fake *emotiontest.Server, maxRetries int, breaker config.EmotionBreaker) *emotion.Client {
+	return emotion.New(config.Emotion{
+		BaseURL: fake.URL,
+		Timeout: time.Second,
+		Retry: config.EmotionRetry{
+			MaxRetries: maxRetries,
+			BaseDelay:  time.Millisecond,
+			MaxDelay:   5 * time.Millisecond,
+		},
+		Breaker: breaker,
+	})
+}
+
+func TestRetriesServerError(t *testing.T) {
+	fake := emotiontest.NewServer()
+	defer fake.Close()
+	client := newClient(fake, 2, config.EmotionBreaker{})
+
+	fake.FailNext(1, emotiontest.FailStatus)
+	tags, err := client.AnalyzePost(context.Background(), "今日は楽しかった", "")
+	if err != nil {
+		t.Fatalf("AnalyzePost: %v", err)
+	}
+	if len(tags) != 1 || tags[0].Type != "joy" {
+		t.Errorf("tags = %v, want joy", tags)
+	}
+	if got := fake.Calls("analyze_post"); got != 2 {
+		t.Errorf("calls = %d, want 2", got)
+	}
+}
+
+func TestRejectsErrorPayload(t *testing.T) {
+	fake := emotiontest.NewServer()
+	defer fake.Close()
+	client := newClient(fake, 0, config.EmotionBreaker{})
+
+	fake.FailNext(1, emotiontest.FailErrorPayload)
+	tags, err := client.AnalyzeReply(context.Background(), "投稿", nil, "返信")
+	var serviceErr *emotion.ServiceError
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("err = %v, want *ServiceError", err)
+	}
+	if tags != nil {
+		t.Errorf("tags = %v, want none", tags)
+	}
+}
+
+func TestDoesNotRetryClientError(t *testing.T) {
+	fake := emotiontest.NewServer()
+	defer fake.Close()
+	client := newClient(fake, 3, config.EmotionBreaker{Threshold: 1, Cooldown: time.Hour})
+
+	fake.FailNext(1, emotiontest.FailInvalidRequest)
+	_, err := client.AnalyzePost(context.Background(), "content", "")
+	var statusErr *emotion.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("err = %v, want 422 *StatusError", err)
+	}
+	if got := fake.Calls("analyze_post"); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+
+	// A bad request says nothing about the service's health
+	if _, err := client.AnalyzePost(context.Background(), "content", ""); err != nil {
+		t.Errorf("AnalyzePost after 4xx: %v, want the breaker to stay closed", err)
+	}
+}
+
+func TestBreakerOpensAndHalfOpens(t *testing.T) {
+	fake := emotiontest.NewServer()
+	defer fake.Close()
+	const cooldown = 50 * time.Millisecond
+	client := newClient(fake, 0, config.EmotionBreaker{Threshold: 2, Cooldown: cooldown})
+
+	var mu sync.Mutex
+	var states []string
+	client.OnBreakerChange(func(state string) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	})
+
+	fake.FailNext(2, emotiontest.FailStatus)
+	for range 2 {
+		if _, err := client.AnalyzePost(context.Background(), "content", ""); err == nil {
+			t.Fatal("AnalyzePost succeeded, want the fake's failure")
+		}
+	}
+	if _, err := client.AnalyzePost(context.Background(), "content", ""); !errors.Is(err, emotion.ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if got := fake.Calls("analyze_post"); got != 2 {
+		t.Errorf("calls = %d, want 2 while open", got)
+	}
+
+	time.Sleep(cooldown + 10*time.Millisecond)
+	if _, err := client.AnalyzePost(context.Background(), "content", ""); err != nil {
+		t.Fatalf("trial call after cooldown: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"open", "half-open", "closed"}; !slices.Equal(states, want) {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+}
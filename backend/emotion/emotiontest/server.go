@@ -0,0 +1,148 @@
+// Package emotiontest provides a fake emotion analysis service speaking the
+// same HTTP API as the Python service, including its failure modes.
+package emotiontest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/emotion"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+)
+
+// Failure is how the fake answers a failed call
+type Failure int
+
+const (
+	// FailStatus answers 500 Internal Server Error
+	FailStatus Failure = iota
+	// FailErrorPayload answers 200 with the service's error payload
+	FailErrorPayload
+	// FailMalformed answers 200 with a body that is not valid JSON
+	FailMalformed
+	// FailInvalidRequest answers 422 as the service does for requests that
+	// don't match its schema
+	FailInvalidRequest
+)
+
+// Server is a running fake; URL is its base URL
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	postTags   []graphdb.EmotionTag
+	replyTags  []graphdb.EmotionTag
+	similarity emotion.TopicSimilarity
+	failures   []Failure
+	calls      map[string]int
+}
+
+// NewServer starts a fake answering every analysis with joy and judging
+// posts to be on different topics. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		postTags:  []graphdb.EmotionTag{{Type: "joy", Score: 0.8}},
+		replyTags: []graphdb.EmotionTag{{Type: "joy", Score: 0.8}},
+		calls:     map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetPostTags sets the answer to analyze_post
+func (s *Server) SetPostTags(tags ...graphdb.EmotionTag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postTags = tags
+}
+
+// SetReplyTags sets the answer to analyze_reply
+func (s *Server) SetReplyTags(tags ...graphdb.EmotionTag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replyTags = tags
+}
+
+// SetSimilarity sets the answer to analyze_topic_similarity
+func (s *Server) SetSimilarity(similarity emotion.TopicSimilarity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.similarity = similarity
+}
+
+// FailNext makes the next n analysis calls fail with f
+func (s *Server) FailNext(n int, f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.failures = append(s.failures, f)
+	}
+}
+
+// Calls returns how many requests endpoint (e.g. "analyze_post") received
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.mu.Lock()
+	s.calls[endpoint]++
+	var failure *Failure
+	if endpoint != "health" && len(s.failures) > 0 {
+		failure = &s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	postTags, replyTags, similarity := s.postTags, s.replyTags, s.similarity
+	s.mu.Unlock()
+
+	var answer any
+	switch endpoint {
+	case "health":
+		answer = map[string]string{"status": "ok"}
+	case "analyze_post":
+		answer = postTags
+	case "analyze_reply":
+		answer = replyTags
+	case "analyze_topic_similarity":
+		answer = similarity
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if failure != nil {
+		switch *failure {
+		case FailStatus:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		case FailMalformed:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{"))
+			return
+		case FailInvalidRequest:
+			http.Error(w, "Unprocessable Entity", http.StatusUnprocessableEntity)
+			return
+		case FailErrorPayload:
+			answer = errorPayload(endpoint)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answer)
+}
+
+// errorPayload mirrors what the Python service returns when the LLM call fails
+func errorPayload(endpoint string) any {
+	const message = "simulated analysis failure"
+	if endpoint == "analyze_topic_similarity" {
+		return map[string]any{"is_same_topic": false, "confidence": 0.0, "error": message}
+	}
+	return []map[string]any{{"emotion": "unknown", "score": 0.0, "error": message}}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/lru"
+)
+
+// emotionCachePruneInterval is how often expired results are deleted from
+// the persistent store
+const emotionCachePruneInterval = time.Hour
+
+// emotionCacheVersion is part of every key; bump it when prompts or the
+// analysis output change so stale results are not served
+const emotionCacheVersion = "v1"
+
+// emotionCache keeps analysis results in memory and, optionally, in Neo4j so
+// identical content is not analysed again
+type emotionCache struct {
+	memory *lru.Cache
+	store  graphdb.GraphDbClient // nil unless the cache is persistent
+	ttl    time.Duration
+}
+
+func newEmotionCache(cfg config.EmotionCache, client graphdb.GraphDbClient) *emotionCache {
+	c := &emotionCache{memory: lru.New(cfg.Size, cfg.TTL), ttl: cfg.TTL}
+	if cfg.Persistent {
+		c.store = client
+	}
+	return c
+}
+
+// emotionCacheKey hashes the normalized inputs of one analysis call
+func emotionCacheKey(endpoint string, inputs ...string) string {
+	h := sha256.New()
+	for _, in := range inputs {
+		h.Write([]byte(normalizeContent(in)))
+		h.Write([]byte{0})
+	}
+	return emotionCacheVersion + ":" + endpoint + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeContent trims and collapses whitespace so trivially different
+// copies of the same text share a cache entry
+func normalizeContent(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// get decodes a cached result for key into out, reporting whether one was found
+func (c *emotionCache) get(ctx context.Context, endpoint, key string, out any) bool {
+	if data, ok := c.memory.Get(key); ok && json.Unmarshal(data, out) == nil {
+		emotionCacheLookups.WithLabelValues(endpoint, "memory_hit").Inc()
+		return true
+	}
+
+	if c.store != nil {
+		data, ttl, found, err := c.store.GetCachedAnalysis(key)
+		if err != nil {
+			loggerFrom(ctx).Warn("failed to read emotion cache", "endpoint", endpoint, "err", err)
+		} else if found && json.Unmarshal(data, out) == nil {
+			// Don't let the memory copy outlive the stored entry
+			c.memory.AddFor(key, data, ttl)
+			emotionCacheLookups.WithLabelValues(endpoint, "store_hit").Inc()
+			return true
+		}
+	}
+
+	emotionCacheLookups.WithLabelValues(endpoint, "miss").Inc()
+	return false
+}
+
+// put stores a successful result under key
+func (c *emotionCache) put(ctx context.Context, endpoint, key string, result any) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	c.memory.Add(key, data)
+
+	if c.store != nil {
+		if err := c.store.PutCachedAnalysis(key, data, c.ttl); err != nil {
+			loggerFrom(ctx).Warn("failed to write emotion cache", "endpoint", endpoint, "err", err)
+		}
+	}
+}
+
+// prune deletes expired results from the persistent store, which would
+// otherwise keep them forever
+func (c *emotionCache) prune(ctx context.Context) {
+	deleted, err := c.store.DeleteExpiredCachedAnalyses()
+	if err != nil {
+		loggerFrom(ctx).Warn("failed to prune emotion cache", "err", err)
+		return
+	}
+	loggerFrom(ctx).Debug("pruned emotion cache", "deleted", deleted)
+}
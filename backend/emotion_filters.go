@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/taxonomy"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+type EmotionFilterRequest struct {
+	// MinScore defaults to 0, hiding everything tagged with the emotion
+	MinScore *float64 `json:"minScore"`
+	Until    string   `json:"until"`
+}
+
+type EmotionFiltersResponse struct {
+	Filters []graphdb.EmotionFilter `json:"filters"`
+}
+
+func (r EmotionFilterRequest) Validate() validation.Errors {
+	v := validation.New()
+	if r.MinScore != nil {
+		v.Check(*r.MinScore >= 0 && *r.MinScore <= 1, "minScore", "must be between 0 and 1")
+	}
+	if r.Until != "" {
+		until, err := time.Parse(time.RFC3339, r.Until)
+		v.Check(err == nil, "until", "must be an RFC 3339 timestamp")
+		v.Check(until.After(time.Now()), "until", "must be in the future")
+	}
+	return v.Errors()
+}
+
+// handleEmotionFilters serves GET /users/{userId}/emotion-filters and PUT and
+// DELETE /users/{userId}/emotion-filters/{emotion}. Filters hide posts and
+// replies from the user's feed, user post listings and reply lists.
+func handleEmotionFilters(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] != "users" || parts[2] != "emotion-filters" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+
+		allowed := r.Method == http.MethodGet
+		if len(parts) == 4 {
+			allowed = r.Method == http.MethodPut || r.Method == http.MethodDelete
+		}
+		if !allowed {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+		logger := loggerFrom(r.Context())
+
+		if r.Method == http.MethodGet {
+			filters, err := client.GetEmotionFilters(userId)
+			if err != nil {
+				logger.Error("failed to get emotion filters", "user_id", userId, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(EmotionFiltersResponse{Filters: filters})
+			return
+		}
+
+		emotion := parts[3]
+		if _, ok := taxonomy.Lookup(emotion); !ok {
+			writeValidationErrors(w, validation.Errors{{Field: "emotion", Message: "must be a canonical emotion"}})
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := client.DeleteEmotionFilter(userId, emotion); err != nil {
+				logger.Error("failed to delete emotion filter", "user_id", userId, "emotion", emotion, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var req EmotionFilterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		filter := graphdb.EmotionFilter{Emotion: emotion}
+		if req.MinScore != nil {
+			filter.MinScore = *req.MinScore
+		}
+		if req.Until != "" {
+			until, _ := time.Parse(time.RFC3339, req.Until)
+			filter.Until = until.UTC().Format(time.RFC3339)
+		}
+		if err := client.SetEmotionFilter(userId, filter); err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to set emotion filter", "user_id", userId, "emotion", emotion, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(filter)
+	}
+}
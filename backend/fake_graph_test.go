@@ -0,0 +1,961 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/google/uuid"
+)
+
+// fakeGraph is an in-memory graphdb.GraphDbClient for handler tests. It keeps
+// the rules handlers depend on (visibility, blocks, follow requests, not
+// found errors) and answers everything else as simply as it can.
+type fakeGraph struct {
+	mu sync.Mutex
+
+	users     map[string]*fakeUser
+	posts     map[string]*fakePost
+	replies   map[string]*fakeReply
+	follows   map[fakeEdge]bool
+	requests  map[fakeEdge]time.Time
+	blocks    map[fakeEdge]bool
+	mutes     map[fakeEdge]bool
+	reposts   map[fakeEdge]time.Time // user -> post
+	reactions map[fakeEdge]string    // user -> post or reply
+	filters   map[string]map[string]graphdb.EmotionFilter
+	tokens    map[string]fakeToken // by hash
+	cache     map[string][]byte
+	phantoms  map[string]bool
+}
+
+type fakeEdge struct{ from, to string }
+
+type fakeUser struct {
+	graphdb.AuthUser
+	displayName string
+	bio         string
+	private     bool
+	avatarKey   string
+	avatarUrl   string
+}
+
+type fakePost struct {
+	id, userId, content, visibility, quoted string
+	createdAt                               time.Time
+	emotions                                []graphdb.EmotionTag
+}
+
+type fakeReply struct {
+	id, postId, parentId, userId, content string
+	createdAt                             time.Time
+	emotions                              []graphdb.EmotionTag
+}
+
+type fakeToken struct{ userId, purpose string }
+
+func newFakeGraph() *fakeGraph {
+	return &fakeGraph{
+		users:     map[string]*fakeUser{},
+		posts:     map[string]*fakePost{},
+		replies:   map[string]*fakeReply{},
+		follows:   map[fakeEdge]bool{},
+		requests:  map[fakeEdge]time.Time{},
+		blocks:    map[fakeEdge]bool{},
+		mutes:     map[fakeEdge]bool{},
+		reposts:   map[fakeEdge]time.Time{},
+		reactions: map[fakeEdge]string{},
+		filters:   map[string]map[string]graphdb.EmotionFilter{},
+		tokens:    map[string]fakeToken{},
+		cache:     map[string][]byte{},
+		phantoms:  map[string]bool{},
+	}
+}
+
+// addUser registers a verified user with a known ID
+func (f *fakeGraph) addUser(id, username, password string, private bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id] = &fakeUser{
+		AuthUser: graphdb.AuthUser{ID: id, Username: username, Email: username + "@example.com", Password: password, EmailVerified: true},
+		private:  private,
+	}
+}
+
+// addPost stores a post tagged with joy
+func (f *fakeGraph) addPost(id, userId, content, visibility string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts[id] = &fakePost{
+		id: id, userId: userId, content: content, visibility: visibility, createdAt: time.Now(),
+		emotions: []graphdb.EmotionTag{{Type: "joy", Score: 0.8, Source: graphdb.TagSourceModel}},
+	}
+}
+
+// addReply stores a reply to a post, or to parentId in its thread
+func (f *fakeGraph) addReply(id, postId, parentId, userId, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies[id] = &fakeReply{id: id, postId: postId, parentId: parentId, userId: userId, content: content, createdAt: time.Now()}
+}
+
+func (f *fakeGraph) blocked(a, b string) bool {
+	return f.blocks[fakeEdge{a, b}] || f.blocks[fakeEdge{b, a}]
+}
+
+// visible mirrors visiblePost in the Neo4j client
+func (f *fakeGraph) visible(viewerId string, p *fakePost) bool {
+	author := f.users[p.userId]
+	switch {
+	case f.blocked(p.userId, viewerId):
+		return false
+	case p.userId == viewerId:
+		return true
+	case p.visibility == "public" && (author == nil || !author.private):
+		return true
+	default:
+		return p.visibility != "private" && f.follows[fakeEdge{viewerId, p.userId}]
+	}
+}
+
+func (f *fakeGraph) requireUser(id string) (*fakeUser, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, &graphdb.NotFoundError{Kind: "user", ID: id}
+	}
+	return u, nil
+}
+
+func (f *fakeGraph) requireVisiblePost(userId, postId string) (*fakePost, error) {
+	p, ok := f.posts[postId]
+	if ok && f.blocked(userId, p.userId) {
+		return nil, graphdb.ErrBlocked
+	}
+	if !ok || !f.visible(userId, p) {
+		return nil, &graphdb.NotFoundError{Kind: "post", ID: postId}
+	}
+	return p, nil
+}
+
+func (f *fakeGraph) requireShareablePost(userId, postId string) (*fakePost, error) {
+	p, err := f.requireVisiblePost(userId, postId)
+	if err != nil {
+		return nil, err
+	}
+	if p.visibility != "public" || f.users[p.userId].private {
+		return nil, graphdb.ErrNotShareable
+	}
+	return p, nil
+}
+
+// requireThreadReply returns a reply in the post's thread
+func (f *fakeGraph) requireThreadReply(postId, replyId string) (*fakeReply, error) {
+	r, ok := f.replies[replyId]
+	if !ok || r.postId != postId {
+		return nil, &graphdb.NotFoundError{Kind: "reply", ID: replyId}
+	}
+	return r, nil
+}
+
+func (f *fakeGraph) summary(id string) graphdb.UserSummary {
+	u := f.users[id]
+	return graphdb.UserSummary{ID: id, Username: u.Username, DisplayName: cmpOr(u.displayName, u.Username), AvatarUrl: u.avatarUrl}
+}
+
+func (f *fakeGraph) details(id string) graphdb.UserDetails {
+	u := f.users[id]
+	d := graphdb.UserDetails{
+		ID: id, Username: u.Username, DisplayName: cmpOr(u.displayName, u.Username), Email: u.Email,
+		AvatarUrl: u.avatarUrl, Bio: u.bio, Private: u.private,
+	}
+	for e := range f.follows {
+		if e.to == id {
+			d.FollowersCount++
+		}
+		if e.from == id {
+			d.FollowingCount++
+		}
+	}
+	return d
+}
+
+func cmpOr(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+func (f *fakeGraph) reactionCounts(target string) map[string]int {
+	counts := map[string]int{}
+	for e, t := range f.reactions {
+		if e.to == target {
+			counts[t]++
+		}
+	}
+	return counts
+}
+
+func (f *fakeGraph) feedPost(p *fakePost) graphdb.FeedPost {
+	fp := graphdb.FeedPost{
+		PostID: p.id, UserID: p.userId, Content: p.content, CreatedAt: p.createdAt.Format(time.RFC3339),
+		EmotionTags: p.emotions, Reactions: f.reactionCounts(p.id), Visibility: p.visibility, QuotedPostID: p.quoted,
+	}
+	for _, r := range f.replies {
+		if r.postId == p.id {
+			fp.ReplyCount++
+		}
+	}
+	for e := range f.reposts {
+		if e.to == p.id {
+			fp.RepostCount++
+		}
+	}
+	for _, q := range f.posts {
+		if q.quoted == p.id {
+			fp.QuoteCount++
+		}
+	}
+	return fp
+}
+
+func (f *fakeGraph) CreatePostWithEmotions(userId, postId, content, visibility, quotedPostId string, emotions, rawEmotions []graphdb.EmotionTag) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return err
+	}
+	if quotedPostId != "" {
+		if _, err := f.requireShareablePost(userId, quotedPostId); err != nil {
+			return err
+		}
+	}
+	f.posts[postId] = &fakePost{
+		id: postId, userId: userId, content: content, visibility: visibility, quoted: quotedPostId,
+		createdAt: time.Now(), emotions: emotions,
+	}
+	return nil
+}
+
+func (f *fakeGraph) Repost(postId, userId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return err
+	}
+	if _, err := f.requireShareablePost(userId, postId); err != nil {
+		return err
+	}
+	if _, ok := f.reposts[fakeEdge{userId, postId}]; !ok {
+		f.reposts[fakeEdge{userId, postId}] = time.Now()
+	}
+	return nil
+}
+
+func (f *fakeGraph) GetPostWithEmotions(postId string, viewer graphdb.Viewer) (string, string, string, string, []graphdb.EmotionTag, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.posts[postId]
+	if !ok || !f.visible(viewer.ID, p) {
+		return "", "", "", "", nil, nil
+	}
+	return p.userId, p.content, p.createdAt.Format(time.RFC3339), p.visibility, p.emotions, nil
+}
+
+func (f *fakeGraph) GetReactions(postId string) (map[string]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reactionCounts(postId), nil
+}
+
+func (f *fakeGraph) AddReaction(postId, userId, reactionType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return err
+	}
+	if _, err := f.requireVisiblePost(userId, postId); err != nil {
+		return err
+	}
+	f.reactions[fakeEdge{userId, postId}] = reactionType
+	return nil
+}
+
+func (f *fakeGraph) AddReplyReaction(postId, replyId, userId, reactionType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return err
+	}
+	if _, err := f.requireVisiblePost(userId, postId); err != nil {
+		return err
+	}
+	r, err := f.requireThreadReply(postId, replyId)
+	if err != nil {
+		return err
+	}
+	if f.blocked(userId, r.userId) {
+		return graphdb.ErrBlocked
+	}
+	f.reactions[fakeEdge{userId, replyId}] = reactionType
+	return nil
+}
+
+func (f *fakeGraph) AddReplyWithEmotions(postId, parentReplyId, userId, content string, emotions, rawEmotions []graphdb.EmotionTag) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return "", err
+	}
+	if _, err := f.requireVisiblePost(userId, postId); err != nil {
+		return "", err
+	}
+	if parentReplyId != "" {
+		parent, err := f.requireThreadReply(postId, parentReplyId)
+		if err != nil {
+			return "", err
+		}
+		if f.blocked(userId, parent.userId) {
+			return "", graphdb.ErrBlocked
+		}
+	}
+	id := uuid.New().String()
+	f.replies[id] = &fakeReply{
+		id: id, postId: postId, parentId: parentReplyId, userId: userId, content: content,
+		createdAt: time.Now(), emotions: emotions,
+	}
+	return id, nil
+}
+
+func (f *fakeGraph) GetReplyChain(postId, replyId string, viewer graphdb.Viewer) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireVisiblePost(viewer.ID, postId); err != nil {
+		return nil, err
+	}
+	r, err := f.requireThreadReply(postId, replyId)
+	if err != nil {
+		return nil, err
+	}
+	if f.blocked(viewer.ID, r.userId) {
+		return nil, graphdb.ErrBlocked
+	}
+	chain := []string{}
+	for ; r != nil; r = f.replies[r.parentId] {
+		if !f.blocked(viewer.ID, r.userId) {
+			chain = append([]string{r.content}, chain...)
+		}
+	}
+	return chain, nil
+}
+
+func (f *fakeGraph) AddInfluence(fromUserID, postID, influenceType string) error {
+	return nil
+}
+
+func (f *fakeGraph) GetReplies(postId string, viewer graphdb.Viewer) ([]graphdb.ReplyItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.posts[postId]
+	if !ok || !f.visible(viewer.ID, p) {
+		return nil, &graphdb.NotFoundError{Kind: "post", ID: postId}
+	}
+
+	// Depth first, so every reply follows its parent
+	items := []graphdb.ReplyItem{}
+	var walk func(parentId string, depth int)
+	walk = func(parentId string, depth int) {
+		var children []*fakeReply
+		for _, r := range f.replies {
+			if r.postId == postId && r.parentId == parentId && !f.blocked(viewer.ID, r.userId) {
+				children = append(children, r)
+			}
+		}
+		slices.SortFunc(children, func(a, b *fakeReply) int { return a.createdAt.Compare(b.createdAt) })
+		for _, r := range children {
+			items = append(items, graphdb.ReplyItem{
+				ReplyID: r.id, UserID: r.userId, Content: r.content, CreatedAt: r.createdAt.Format(time.RFC3339),
+				EmotionTags: r.emotions, ParentReplyID: r.parentId, Depth: depth, Reactions: f.reactionCounts(r.id),
+			})
+			i := len(items) - 1
+			walk(r.id, depth+1)
+			items[i].ChildCount = len(items) - 1 - i
+		}
+	}
+	walk("", 0)
+	return items, nil
+}
+
+func (f *fakeGraph) GetFeed(viewer graphdb.Viewer, emotionFilter string) ([]graphdb.FeedPost, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	posts := []graphdb.FeedPost{}
+	for _, p := range f.posts {
+		if f.visible(viewer.ID, p) && !f.mutes[fakeEdge{viewer.ID, p.userId}] {
+			posts = append(posts, f.feedPost(p))
+		}
+	}
+	for e, at := range f.reposts {
+		p := f.posts[e.to]
+		if f.follows[fakeEdge{viewer.ID, e.from}] && f.visible(viewer.ID, p) {
+			fp := f.feedPost(p)
+			fp.RepostedBy, fp.RepostedAt = e.from, at.Format(time.RFC3339)
+			posts = append(posts, fp)
+		}
+	}
+	return posts, nil
+}
+
+func (f *fakeGraph) GetAllEmotionTags() ([]graphdb.EmotionTagOnly, error) {
+	return []graphdb.EmotionTagOnly{{Type: "joy"}, {Type: "sadness"}}, nil
+}
+
+func (f *fakeGraph) Search(query graphdb.SearchQuery) (graphdb.SearchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := graphdb.SearchResult{Facets: map[string]int{}}
+	for _, p := range f.posts {
+		if !f.visible(query.ViewerID, p) || !strings.Contains(p.content, strings.Trim(query.Text, `"`)) {
+			continue
+		}
+		result.Total++
+		result.Hits = append(result.Hits, graphdb.SearchHit{
+			Kind: "post", ID: p.id, PostID: p.id, UserID: p.userId, Content: p.content,
+			CreatedAt: p.createdAt.Format(time.RFC3339), Score: 1, EmotionTags: p.emotions,
+		})
+		for _, e := range p.emotions {
+			result.Facets[e.Type]++
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeGraph) GetEmotionTagStats(window time.Duration) ([]graphdb.EmotionTagStats, error) {
+	return []graphdb.EmotionTagStats{
+		{Type: "joy", UsageCount: 3, AverageScore: 0.8, LastUsedAt: time.Now(), RecentCount: 2, PreviousCount: 1},
+		{Type: "sadness"},
+	}, nil
+}
+
+func (f *fakeGraph) CorrectPostEmotions(postId, userId string, emotions []graphdb.EmotionTag) ([]graphdb.EmotionTag, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.posts[postId]
+	if !ok {
+		return nil, &graphdb.NotFoundError{Kind: "post", ID: postId}
+	}
+	p.emotions = nil
+	for _, e := range emotions {
+		p.emotions = append(p.emotions, graphdb.EmotionTag{Type: e.Type, Score: e.Score, Source: graphdb.TagSourceUser})
+	}
+	return p.emotions, nil
+}
+
+func (f *fakeGraph) GetEmotionCorrections(since string, limit int) ([]graphdb.EmotionCorrection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	corrections := []graphdb.EmotionCorrection{}
+	for _, p := range f.posts {
+		if len(p.emotions) > 0 && p.emotions[0].Source == graphdb.TagSourceUser {
+			corrections = append(corrections, graphdb.EmotionCorrection{
+				PostID: p.id, Content: p.content, RawEmotions: []graphdb.EmotionTag{}, ModelEmotions: []graphdb.EmotionTag{},
+				UserEmotions: p.emotions, CorrectedBy: p.userId, CorrectedAt: time.Now().Format(time.RFC3339),
+			})
+		}
+	}
+	return corrections, nil
+}
+
+func (f *fakeGraph) SyncEmotionTaxonomy(defs []graphdb.EmotionDefinition) error {
+	return nil
+}
+
+func (f *fakeGraph) MergeEmotions(from []string, into string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	retagged := 0
+	for _, p := range f.posts {
+		for i, e := range p.emotions {
+			if slices.Contains(from, e.Type) {
+				p.emotions[i].Type = into
+				retagged++
+			}
+		}
+	}
+	return retagged, nil
+}
+
+func (f *fakeGraph) FollowUser(userId, targetUserId string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return false, err
+	}
+	target, err := f.requireUser(targetUserId)
+	if err != nil {
+		return false, err
+	}
+	if f.blocked(userId, targetUserId) {
+		return false, graphdb.ErrBlocked
+	}
+	if target.private && !f.follows[fakeEdge{userId, targetUserId}] {
+		f.requests[fakeEdge{userId, targetUserId}] = time.Now()
+		return true, nil
+	}
+	f.follows[fakeEdge{userId, targetUserId}] = true
+	return false, nil
+}
+
+func (f *fakeGraph) UnfollowUser(userId, targetUserId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.follows, fakeEdge{userId, targetUserId})
+	delete(f.requests, fakeEdge{userId, targetUserId})
+	return nil
+}
+
+func (f *fakeGraph) GetFollowers(userId string) ([]graphdb.UserDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := []graphdb.UserDetails{}
+	for e := range f.follows {
+		if e.to == userId {
+			users = append(users, f.details(e.from))
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeGraph) GetFollowing(userId string) ([]graphdb.UserDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := []graphdb.UserDetails{}
+	for e := range f.follows {
+		if e.from == userId {
+			users = append(users, f.details(e.to))
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeGraph) BlockUser(userId, targetUserId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(targetUserId); err != nil {
+		return err
+	}
+	f.blocks[fakeEdge{userId, targetUserId}] = true
+	for _, e := range []fakeEdge{{userId, targetUserId}, {targetUserId, userId}} {
+		delete(f.follows, e)
+		delete(f.requests, e)
+	}
+	return nil
+}
+
+func (f *fakeGraph) UnblockUser(userId, targetUserId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.blocks, fakeEdge{userId, targetUserId})
+	return nil
+}
+
+func (f *fakeGraph) GetBlockedUsers(userId string) ([]graphdb.UserSummary, error) {
+	return f.relatedUsers(f.blocks, userId), nil
+}
+
+func (f *fakeGraph) MuteUser(userId, targetUserId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(targetUserId); err != nil {
+		return err
+	}
+	f.mutes[fakeEdge{userId, targetUserId}] = true
+	return nil
+}
+
+func (f *fakeGraph) UnmuteUser(userId, targetUserId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.mutes, fakeEdge{userId, targetUserId})
+	return nil
+}
+
+func (f *fakeGraph) GetMutedUsers(userId string) ([]graphdb.UserSummary, error) {
+	return f.relatedUsers(f.mutes, userId), nil
+}
+
+func (f *fakeGraph) relatedUsers(edges map[fakeEdge]bool, userId string) []graphdb.UserSummary {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := []graphdb.UserSummary{}
+	for e := range edges {
+		if e.from == userId {
+			users = append(users, f.summary(e.to))
+		}
+	}
+	return users
+}
+
+func (f *fakeGraph) GetFollowRequests(userId string) ([]graphdb.UserSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := []graphdb.UserSummary{}
+	for e := range f.requests {
+		if e.to == userId {
+			users = append(users, f.summary(e.from))
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeGraph) ApproveFollowRequest(userId, requesterId string) error {
+	return f.resolveFollowRequest(userId, requesterId, true)
+}
+
+func (f *fakeGraph) DenyFollowRequest(userId, requesterId string) error {
+	return f.resolveFollowRequest(userId, requesterId, false)
+}
+
+func (f *fakeGraph) resolveFollowRequest(userId, requesterId string, approve bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := fakeEdge{requesterId, userId}
+	if _, ok := f.requests[e]; !ok {
+		return &graphdb.NotFoundError{Kind: "follow request", ID: requesterId}
+	}
+	delete(f.requests, e)
+	if approve {
+		f.follows[e] = true
+	}
+	return nil
+}
+
+func (f *fakeGraph) GetEmotionFilters(userId string) ([]graphdb.EmotionFilter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	filters := []graphdb.EmotionFilter{}
+	for _, filter := range f.filters[userId] {
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func (f *fakeGraph) SetEmotionFilter(userId string, filter graphdb.EmotionFilter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return err
+	}
+	if f.filters[userId] == nil {
+		f.filters[userId] = map[string]graphdb.EmotionFilter{}
+	}
+	f.filters[userId][filter.Emotion] = filter
+	return nil
+}
+
+func (f *fakeGraph) DeleteEmotionFilter(userId, emotion string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.filters[userId], emotion)
+	return nil
+}
+
+func (f *fakeGraph) GetPostContent(postId string, viewer graphdb.Viewer) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.requireVisiblePost(viewer.ID, postId)
+	if err != nil {
+		return "", err
+	}
+	return p.content, nil
+}
+
+func (f *fakeGraph) GetShareablePostContent(postId, userId string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.requireShareablePost(userId, postId)
+	if err != nil {
+		return "", err
+	}
+	return p.content, nil
+}
+
+func (f *fakeGraph) GetInfluencedPostsLast24Hours(userId string) ([]graphdb.InfluencedPost, error) {
+	return []graphdb.InfluencedPost{}, nil
+}
+
+func (f *fakeGraph) AddSameTopicRelation(fromPostID, toPostID string) error {
+	return nil
+}
+
+func (f *fakeGraph) GetPostInfluence(postId string, viewer graphdb.Viewer) (graphdb.PostInfluence, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	influence := graphdb.PostInfluence{
+		FirstDegree:  []graphdb.InfluenceUser{},
+		SecondDegree: []graphdb.InfluenceUser{},
+		ThirdDegree:  []graphdb.InfluenceUser{},
+	}
+	if p, ok := f.posts[postId]; ok && f.visible(viewer.ID, p) {
+		for e, t := range f.reactions {
+			if e.to == postId {
+				influence.FirstDegree = append(influence.FirstDegree, graphdb.InfluenceUser{UserID: e.from, Type: t})
+			}
+		}
+	}
+	return influence, nil
+}
+
+func (f *fakeGraph) CreateUser(username, email, password string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if strings.EqualFold(u.Email, email) {
+			return "", graphdb.ErrEmailTaken
+		}
+		if strings.EqualFold(u.Username, username) {
+			return "", graphdb.ErrUsernameTaken
+		}
+	}
+	id := uuid.New().String()
+	f.users[id] = &fakeUser{AuthUser: graphdb.AuthUser{ID: id, Username: username, Email: email, Password: password}}
+	return id, nil
+}
+
+func (f *fakeGraph) findUser(match func(u *fakeUser) bool) (graphdb.AuthUser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if match(u) {
+			return u.AuthUser, nil
+		}
+	}
+	return graphdb.AuthUser{}, &graphdb.NotFoundError{Kind: "user"}
+}
+
+func (f *fakeGraph) GetUserByEmail(email string) (graphdb.AuthUser, error) {
+	return f.findUser(func(u *fakeUser) bool { return strings.EqualFold(u.Email, email) })
+}
+
+func (f *fakeGraph) GetUserById(userId string) (graphdb.AuthUser, error) {
+	return f.findUser(func(u *fakeUser) bool { return u.ID == userId })
+}
+
+func (f *fakeGraph) GetUserByUsername(username string) (graphdb.AuthUser, error) {
+	return f.findUser(func(u *fakeUser) bool { return strings.EqualFold(u.Username, username) })
+}
+
+func (f *fakeGraph) ValidateUserCredentials(login, password string) (string, error) {
+	user, err := f.findUser(func(u *fakeUser) bool {
+		return strings.EqualFold(u.Email, login) || strings.EqualFold(u.Username, login)
+	})
+	if err != nil || user.Password != password {
+		return "", errors.New("invalid credentials")
+	}
+	return user.ID, nil
+}
+
+func (f *fakeGraph) CreateAccountToken(userId, purpose, tokenHash string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens[tokenHash] = fakeToken{userId: userId, purpose: purpose}
+	return nil
+}
+
+func (f *fakeGraph) ConsumeAccountToken(purpose, tokenHash string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tokens[tokenHash]
+	if !ok || t.purpose != purpose {
+		return "", nil
+	}
+	delete(f.tokens, tokenHash)
+	return t.userId, nil
+}
+
+func (f *fakeGraph) MarkEmailVerified(userId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, err := f.requireUser(userId)
+	if err != nil {
+		return err
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+func (f *fakeGraph) UpdatePassword(userId, password string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, err := f.requireUser(userId)
+	if err != nil {
+		return err
+	}
+	u.Password = password
+	return nil
+}
+
+func (f *fakeGraph) DeleteUser(userId string, purge bool) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, err := f.requireUser(userId)
+	if err != nil {
+		return "", err
+	}
+	delete(f.users, userId)
+	for _, edges := range []map[fakeEdge]bool{f.follows, f.blocks, f.mutes} {
+		for e := range edges {
+			if e.from == userId || e.to == userId {
+				delete(edges, e)
+			}
+		}
+	}
+	if purge {
+		for id, p := range f.posts {
+			if p.userId == userId {
+				delete(f.posts, id)
+			}
+		}
+	}
+	return u.avatarKey, nil
+}
+
+func (f *fakeGraph) FindPhantomUsers() ([]graphdb.PhantomUser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := []graphdb.PhantomUser{}
+	for id := range f.phantoms {
+		users = append(users, graphdb.PhantomUser{ID: id})
+	}
+	return users, nil
+}
+
+func (f *fakeGraph) DeletePhantomUsers() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	removed := len(f.phantoms)
+	clear(f.phantoms)
+	return removed, nil
+}
+
+func (f *fakeGraph) GetUserWithDetails(userId string) (graphdb.UserDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.requireUser(userId); err != nil {
+		return graphdb.UserDetails{}, err
+	}
+	return f.details(userId), nil
+}
+
+func (f *fakeGraph) UpdateUserProfile(userId string, update graphdb.ProfileUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, err := f.requireUser(userId)
+	if err != nil {
+		return err
+	}
+	if update.DisplayName != nil {
+		u.displayName = *update.DisplayName
+	}
+	if update.Bio != nil {
+		u.bio = *update.Bio
+	}
+	if update.Private != nil {
+		u.private = *update.Private
+	}
+	return nil
+}
+
+func (f *fakeGraph) SetUserAvatar(userId, key, url string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, err := f.requireUser(userId)
+	if err != nil {
+		return "", err
+	}
+	previous := u.avatarKey
+	u.avatarKey, u.avatarUrl = key, url
+	return previous, nil
+}
+
+func (f *fakeGraph) GetUserPosts(userId string, viewer graphdb.Viewer) ([]graphdb.FeedPost, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	posts := []graphdb.FeedPost{}
+	for _, p := range f.posts {
+		if p.userId == userId && f.visible(viewer.ID, p) {
+			posts = append(posts, f.feedPost(p))
+		}
+	}
+	return posts, nil
+}
+
+func (f *fakeGraph) CountFollowers(userId string) (int, error) {
+	d, err := f.GetUserWithDetails(userId)
+	return d.FollowersCount, err
+}
+
+func (f *fakeGraph) CountFollowing(userId string) (int, error) {
+	d, err := f.GetUserWithDetails(userId)
+	return d.FollowingCount, err
+}
+
+func (f *fakeGraph) SearchUsers(text string, limit int) ([]graphdb.UserSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Match the first term of userSearchQuery's username:"term" clause
+	prefix, _, _ := strings.Cut(strings.TrimPrefix(text, `(username:"`), `"`)
+	users := []graphdb.UserSummary{}
+	for id, u := range f.users {
+		if strings.HasPrefix(strings.ToLower(u.Username), prefix) && len(users) < limit {
+			users = append(users, f.summary(id))
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeGraph) GetUserSuggestions(userId string, limit int) ([]graphdb.UserSuggestion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	suggestions := []graphdb.UserSuggestion{}
+	for id := range f.users {
+		if id != userId && !f.follows[fakeEdge{userId, id}] && !f.blocked(userId, id) && len(suggestions) < limit {
+			suggestions = append(suggestions, graphdb.UserSuggestion{UserSummary: f.summary(id), Score: 0.5})
+		}
+	}
+	return suggestions, nil
+}
+
+func (f *fakeGraph) GetCachedAnalysis(key string) ([]byte, time.Duration, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.cache[key]
+	return value, time.Hour, ok, nil
+}
+
+func (f *fakeGraph) PutCachedAnalysis(key string, value []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cache[key] = value
+	return nil
+}
+
+func (f *fakeGraph) DeleteExpiredCachedAnalyses() (int, error) {
+	return 0, nil
+}
+
+func (f *fakeGraph) EnsureSchema() error {
+	return nil
+}
+
+func (f *fakeGraph) VerifyConnectivity(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeGraph) Close() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+)
+
+// handleFollowRequests serves GET /users/{userId}/follow-requests and POST
+// /users/{userId}/follow-requests/{requesterId}/approve and .../deny. Only
+// the private account being followed can see and resolve its requests.
+func handleFollowRequests(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 && len(parts) != 5 || parts[0] != "users" || parts[2] != "follow-requests" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+
+		var resolve func(userId, requesterId string) error
+		var status string
+		if len(parts) == 5 {
+			switch parts[4] {
+			case "approve":
+				resolve, status = client.ApproveFollowRequest, "approved"
+			case "deny":
+				resolve, status = client.DenyFollowRequest, "denied"
+			default:
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		allowed := r.Method == http.MethodGet
+		if resolve != nil {
+			allowed = r.Method == http.MethodPost
+		}
+		if !allowed {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+		logger := loggerFrom(r.Context())
+
+		if resolve == nil {
+			users, err := client.GetFollowRequests(userId)
+			if err != nil {
+				logger.Error("failed to get follow requests", "user_id", userId, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(UsersResponse{Users: users})
+			return
+		}
+
+		requesterId := parts[3]
+		if errs := validatePathIDs("requesterId", requesterId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		if err := resolve(userId, requesterId); err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to resolve follow request", "user_id", userId, "requester_id", requesterId, "status", status, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if status == "approved" {
+			followsCreated.Inc()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UserRelationResponse{Status: status})
+	}
+}
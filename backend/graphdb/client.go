@@ -1,10 +1,52 @@
 package graphdb
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrBlocked is returned when a user tries to follow, react to or reply to
+// someone they have blocked or who has blocked them
+var ErrBlocked = errors.New("blocked")
+
+// ErrNotShareable is returned when a user tries to repost or quote a post
+// that isn't public, as sharing it would show it to people it was hidden from
+var ErrNotShareable = errors.New("post not shareable")
+
+// ErrEmailTaken and ErrUsernameTaken are returned by CreateUser when another
+// account already uses the email address or, ignoring case, the username
+var (
+	ErrEmailTaken    = errors.New("email already exists")
+	ErrUsernameTaken = errors.New("username already exists")
+)
+
+// NotFoundError reports that a user or post a query refers to doesn't exist
+type NotFoundError struct {
+	Kind string // "user", "post"
+	ID   string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ID == "" {
+		return e.Kind + " not found"
+	}
+	return e.Kind + " " + e.ID + " not found"
+}
+
 type EmotionTag struct {
 	Type  string  `json:"emotion"`
 	Score float64 `json:"score"`
+	// Source is TagSourceModel or TagSourceUser for stored tags, empty for
+	// analyzer output that has not been stored yet
+	Source string `json:"source,omitempty"`
 }
 
+const (
+	TagSourceModel = "model"
+	TagSourceUser  = "user"
+)
+
 type InfluencedPost struct {
 	PostID  string `json:"postId"`
 	Content string `json:"content"`
@@ -16,6 +58,12 @@ type ReplyItem struct {
 	Content     string       `json:"content"`
 	CreatedAt   string       `json:"createdAt"`
 	EmotionTags []EmotionTag `json:"emotionTags"`
+	// ParentReplyID is empty for replies directly to the post, which are at
+	// Depth 0
+	ParentReplyID string         `json:"parentReplyId,omitempty"`
+	Depth         int            `json:"depth"`
+	ChildCount    int            `json:"childCount"`
+	Reactions     map[string]int `json:"reactions"`
 }
 
 type FeedPost struct {
@@ -26,6 +74,82 @@ type FeedPost struct {
 	EmotionTags []EmotionTag   `json:"emotionTags"`
 	Reactions   map[string]int `json:"reactions"`
 	ReplyCount  int            `json:"replyCount"`
+	Visibility  string         `json:"visibility"`
+	RepostCount int            `json:"repostCount"`
+	QuoteCount  int            `json:"quoteCount"`
+	// QuotedPostID is set on quote posts
+	QuotedPostID string `json:"quotedPostId,omitempty"`
+	// RepostedBy and RepostedAt are set on feed entries that are there
+	// because someone the viewer follows reposted the post
+	RepostedBy string `json:"repostedBy,omitempty"`
+	RepostedAt string `json:"repostedAt,omitempty"`
+}
+
+// EmotionDefinition describes a canonical Emotion node. Parent is the
+// broader emotion it belongs to, empty for top-level emotions.
+type EmotionDefinition struct {
+	Type      string
+	Parent    string
+	Intensity int
+}
+
+// EmotionTagStats summarizes how an emotion has been used to tag posts and
+// replies. Recent and previous counts cover the last window and the window
+// before it.
+type EmotionTagStats struct {
+	Type          string
+	UsageCount    int
+	AverageScore  float64
+	LastUsedAt    time.Time // zero if never used
+	RecentCount   int
+	PreviousCount int
+}
+
+// EmotionCorrection is a post whose tags were corrected by its author,
+// paired with what the model produced, for use as labeled training data
+type EmotionCorrection struct {
+	PostID        string       `json:"postId"`
+	Content       string       `json:"content"`
+	RawEmotions   []EmotionTag `json:"rawEmotions"`   // analyzer output before normalization
+	ModelEmotions []EmotionTag `json:"modelEmotions"` // tags stored before the first correction
+	UserEmotions  []EmotionTag `json:"userEmotions"`  // tags after the latest correction
+	CorrectedBy   string       `json:"correctedBy"`
+	CorrectedAt   string       `json:"correctedAt"`
+}
+
+// SearchQuery filters a full-text search. Text is a Lucene query; the other
+// fields are ignored when empty. From and To are RFC 3339 timestamps.
+type SearchQuery struct {
+	Text     string
+	Emotion  string
+	AuthorID string
+	From     string
+	To       string
+	Limit    int
+	Offset   int
+	// ViewerID is who is searching, empty for anonymous readers. Posts by
+	// private accounts they don't follow, and replies to them, are left out.
+	ViewerID string
+}
+
+// SearchHit is a matching post or reply. For replies PostID is the post
+// replied to; for posts it equals ID.
+type SearchHit struct {
+	Kind        string // "post" or "reply"
+	ID          string
+	PostID      string
+	UserID      string
+	Content     string
+	CreatedAt   string
+	Score       float64
+	EmotionTags []EmotionTag
+}
+
+type SearchResult struct {
+	Total int
+	Hits  []SearchHit
+	// Facets counts matches per emotion, ignoring the emotion filter
+	Facets map[string]int
 }
 
 type EmotionTagOnly struct {
@@ -50,8 +174,16 @@ type AuthUser struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"-"` // Password is never returned in JSON
+	// EmailVerified is true for accounts created before verification existed
+	EmailVerified bool `json:"emailVerified"`
 }
 
+// Purposes of one-time account tokens
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
 // UserDetails contains user information with follower and following counts
 type UserDetails struct {
 	ID             string `json:"id"`
@@ -62,38 +194,187 @@ type UserDetails struct {
 	Bio            string `json:"bio"`
 	FollowersCount int    `json:"followersCount"`
 	FollowingCount int    `json:"followingCount"`
+	// Private accounts approve their followers; only followers see their posts
+	Private bool `json:"private"`
+}
+
+// ProfileUpdate sets the fields that are non-nil and leaves the others alone
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	// Making an account public approves its pending follow requests
+	Private *bool
+}
+
+// UserSummary is the public part of a user shown in lists
+type UserSummary struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	AvatarUrl   string `json:"avatarUrl"`
+}
+
+// UserSuggestion is someone a user may want to follow. MutualFollows counts
+// the users they follow who follow the suggestion; EmotionSimilarity is the
+// cosine similarity (0-1) of the two users' emotion profiles.
+type UserSuggestion struct {
+	UserSummary
+	MutualFollows     int     `json:"mutualFollows"`
+	EmotionSimilarity float64 `json:"emotionSimilarity"`
+	Score             float64 `json:"score"`
+}
+
+// PhantomUser is a User node with no account behind it, left over from when
+// posting, reacting, replying and following created users for unknown IDs
+type PhantomUser struct {
+	ID        string `json:"id"`
+	Posts     int    `json:"posts"`
+	Replies   int    `json:"replies"`
+	Reactions int    `json:"reactions"`
+	Follows   int    `json:"follows"` // in either direction
+}
+
+// Viewer is who a listing of posts or replies is for. Content by users the
+// viewer has blocked or muted is hidden, and so is content matching their
+// emotion filters unless ShowFiltered is set. ID is empty for anonymous
+// readers.
+type Viewer struct {
+	ID           string
+	ShowFiltered bool
+}
+
+// EmotionFilter hides posts and replies tagged with Emotion, or one of its
+// milder or more intense forms, at MinScore or above
+type EmotionFilter struct {
+	Emotion  string  `json:"emotion"`
+	MinScore float64 `json:"minScore"`
+	// Until is an RFC 3339 time after which the filter stops applying, or
+	// empty to keep it until it is removed
+	Until string `json:"until,omitempty"`
 }
 
 type GraphDbClient interface {
-	CreatePostWithEmotions(userId, postId, content string, emotions []EmotionTag) error
-	GetPostWithEmotions(postId string) (userId, content, createdAt string, emotions []EmotionTag, err error)
+	// CreatePostWithEmotions stores visibility as given (see
+	// validation.PostVisibilities) and rawEmotions, the analyzer's unfiltered
+	// output, for auditing. A non-empty quotedPostId makes it a quote post,
+	// which fails with ErrNotShareable unless the quoted post is public.
+	CreatePostWithEmotions(userId, postId, content, visibility, quotedPostId string, emotions, rawEmotions []EmotionTag) error
+	// Repost shares a public post with the user's followers
+	Repost(postId, userId string) error
+	// GetPostWithEmotions returns an empty userId when the post doesn't exist
+	// or the viewer may not see it
+	GetPostWithEmotions(postId string, viewer Viewer) (userId, content, createdAt, visibility string, emotions []EmotionTag, err error)
 	GetReactions(postId string) (map[string]int, error)
 	AddReaction(postId, userId, reactionType string) error
-	AddReplyWithEmotions(postId, userId, content string, emotions []EmotionTag) (replyId string, err error)
+	AddReplyReaction(postId, replyId, userId, reactionType string) error
+	// AddReplyWithEmotions replies to the post, or to parentReplyId in the
+	// post's thread when it isn't empty
+	AddReplyWithEmotions(postId, parentReplyId, userId, content string, emotions, rawEmotions []EmotionTag) (replyId string, err error)
+	// GetReplyChain returns the contents of a reply and its ancestors, oldest
+	// first, failing with a *NotFoundError unless the reply is in the thread
+	// of a post the viewer can see, and with ErrBlocked if the viewer can't
+	// reply to the post or the reply. Ancestors by users the viewer blocked
+	// or who blocked the viewer are left out.
+	GetReplyChain(postId, replyId string, viewer Viewer) ([]string, error)
 	AddInfluence(fromUserID, postID, influenceType string) error
-	GetReplies(postId string) ([]ReplyItem, error)
-	GetFeed(emotionFilter string) ([]FeedPost, error)
+	// GetReplies hides replies by users who blocked the viewer or whom the
+	// viewer blocked, and fails with a *NotFoundError for posts the viewer
+	// can't see.
+	// Replies come in thread order: each one right after its parent.
+	GetReplies(postId string, viewer Viewer) ([]ReplyItem, error)
+	// GetFeed hides posts by users who blocked the viewer or whom the viewer
+	// blocked or muted
+	GetFeed(viewer Viewer, emotionFilter string) ([]FeedPost, error)
 	GetAllEmotionTags() ([]EmotionTagOnly, error)
-	FollowUser(userId, targetUserId string) error
+	Search(query SearchQuery) (SearchResult, error)
+	GetEmotionTagStats(window time.Duration) ([]EmotionTagStats, error)
+	CorrectPostEmotions(postId, userId string, emotions []EmotionTag) ([]EmotionTag, error)
+	GetEmotionCorrections(since string, limit int) ([]EmotionCorrection, error)
+	SyncEmotionTaxonomy(defs []EmotionDefinition) error
+	MergeEmotions(from []string, into string) (retagged int, err error)
+	// FollowUser follows public accounts right away. For private accounts it
+	// leaves a follow request for the target to approve and returns true.
+	FollowUser(userId, targetUserId string) (requested bool, err error)
+	// UnfollowUser also withdraws a pending follow request
 	UnfollowUser(userId, targetUserId string) error
 	GetFollowers(userId string) ([]UserDetails, error)
 	GetFollowing(userId string) ([]UserDetails, error)
-	GetPostContent(postId string) (content string, err error)
+	// BlockUser also removes follows between the two users in both directions
+	BlockUser(userId, targetUserId string) error
+	UnblockUser(userId, targetUserId string) error
+	GetBlockedUsers(userId string) ([]UserSummary, error)
+	MuteUser(userId, targetUserId string) error
+	UnmuteUser(userId, targetUserId string) error
+	GetMutedUsers(userId string) ([]UserSummary, error)
+	// GetFollowRequests lists users waiting for userId's approval, oldest first
+	GetFollowRequests(userId string) ([]UserSummary, error)
+	ApproveFollowRequest(userId, requesterId string) error
+	DenyFollowRequest(userId, requesterId string) error
+	// GetEmotionFilters lists the user's filters that haven't expired
+	GetEmotionFilters(userId string) ([]EmotionFilter, error)
+	// SetEmotionFilter creates or replaces the user's filter for an emotion
+	SetEmotionFilter(userId string, filter EmotionFilter) error
+	DeleteEmotionFilter(userId, emotion string) error
+	// GetPostContent fails like GetReplyChain when the viewer can't see or
+	// reply to the post
+	GetPostContent(postId string, viewer Viewer) (content string, err error)
+	// GetShareablePostContent returns a post's content only if userId may
+	// repost or quote it, failing like Repost otherwise
+	GetShareablePostContent(postId, userId string) (content string, err error)
 	GetInfluencedPostsLast24Hours(userId string) ([]InfluencedPost, error)
 	AddSameTopicRelation(fromPostID, toPostID string) error
-	GetPostInfluence(postId string) (PostInfluence, error)
+	// GetPostInfluence leaves out posts the viewer can't see
+	GetPostInfluence(postId string, viewer Viewer) (PostInfluence, error)
 
 	// User authentication methods
 	CreateUser(username, email, password string) (string, error)
 	GetUserByEmail(email string) (AuthUser, error)
 	GetUserById(userId string) (AuthUser, error)
-	ValidateUserCredentials(email, password string) (string, error)
+	GetUserByUsername(username string) (AuthUser, error)
+	// login is an email address or a username
+	ValidateUserCredentials(login, password string) (string, error)
+
+	// Account lifecycle. Tokens are stored as hashes; creating one replaces
+	// the user's earlier tokens for the same purpose.
+	CreateAccountToken(userId, purpose, tokenHash string, ttl time.Duration) error
+	// ConsumeAccountToken deletes an unexpired token and returns its user,
+	// or "" if there is no such token
+	ConsumeAccountToken(purpose, tokenHash string) (userId string, err error)
+	MarkEmailVerified(userId string) error
+	// UpdatePassword also invalidates outstanding password reset tokens
+	UpdatePassword(userId, password string) error
+	// DeleteUser removes the user's reactions, follows and tokens. With purge
+	// their posts and replies (and every reply under them) are deleted along
+	// with the user; otherwise the user is anonymized and their content kept.
+	// It returns the key of the avatar to delete from the blob store.
+	DeleteUser(userId string, purge bool) (avatarKey string, err error)
+	FindPhantomUsers() ([]PhantomUser, error)
+	// DeletePhantomUsers deletes phantom users with their posts and replies
+	// (and every reply under them) and returns how many users were removed
+	DeletePhantomUsers() (int, error)
 
 	// User profile methods
 	GetUserWithDetails(userId string) (UserDetails, error)
-	GetUserPosts(userId string) ([]FeedPost, error)
+	UpdateUserProfile(userId string, update ProfileUpdate) error
+	// SetUserAvatar records the avatar's blob key and URL, or removes the
+	// avatar when both are empty, and returns the key it replaced
+	SetUserAvatar(userId, key, url string) (previousKey string, err error)
+	GetUserPosts(userId string, viewer Viewer) ([]FeedPost, error)
 	CountFollowers(userId string) (int, error)
 	CountFollowing(userId string) (int, error)
+	// text is a Lucene query over username and displayName
+	SearchUsers(text string, limit int) ([]UserSummary, error)
+	GetUserSuggestions(userId string, limit int) ([]UserSuggestion, error)
+
+	// Emotion analysis cache, keyed by content hash. GetCachedAnalysis also
+	// returns how long the entry has left before it expires.
+	GetCachedAnalysis(key string) (value []byte, ttl time.Duration, found bool, err error)
+	PutCachedAnalysis(key string, value []byte, ttl time.Duration) error
+	// DeleteExpiredCachedAnalyses returns how many entries were removed
+	DeleteExpiredCachedAnalyses() (int, error)
 
+	// EnsureSchema creates the indexes and constraints the queries rely on
+	EnsureSchema() error
+	VerifyConnectivity(ctx context.Context) error
 	Close() error
 }
@@ -0,0 +1,472 @@
+package graphdb
+
+import (
+	"context"
+	"time"
+)
+
+// QueryObserver is called after every GraphDbClient call with the method
+// name, how long it took and the error it returned.
+type QueryObserver func(method string, duration time.Duration, err error)
+
+type instrumentedClient struct {
+	inner   GraphDbClient
+	observe QueryObserver
+}
+
+// NewInstrumentedClient wraps client so every call is reported to observe
+func NewInstrumentedClient(client GraphDbClient, observe QueryObserver) GraphDbClient {
+	return &instrumentedClient{inner: client, observe: observe}
+}
+
+func (c *instrumentedClient) CreatePostWithEmotions(userId, postId, content, visibility, quotedPostId string, emotions, rawEmotions []EmotionTag) error {
+	start := time.Now()
+	err := c.inner.CreatePostWithEmotions(userId, postId, content, visibility, quotedPostId, emotions, rawEmotions)
+	c.observe("CreatePostWithEmotions", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) Repost(postId, userId string) error {
+	start := time.Now()
+	err := c.inner.Repost(postId, userId)
+	c.observe("Repost", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetPostWithEmotions(postId string, viewer Viewer) (string, string, string, string, []EmotionTag, error) {
+	start := time.Now()
+	r0, r1, r2, r3, r4, err := c.inner.GetPostWithEmotions(postId, viewer)
+	c.observe("GetPostWithEmotions", time.Since(start), err)
+	return r0, r1, r2, r3, r4, err
+}
+
+func (c *instrumentedClient) GetReactions(postId string) (map[string]int, error) {
+	start := time.Now()
+	r0, err := c.inner.GetReactions(postId)
+	c.observe("GetReactions", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) AddReaction(postId, userId, reactionType string) error {
+	start := time.Now()
+	err := c.inner.AddReaction(postId, userId, reactionType)
+	c.observe("AddReaction", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) AddReplyReaction(postId, replyId, userId, reactionType string) error {
+	start := time.Now()
+	err := c.inner.AddReplyReaction(postId, replyId, userId, reactionType)
+	c.observe("AddReplyReaction", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) AddReplyWithEmotions(postId, parentReplyId, userId, content string, emotions, rawEmotions []EmotionTag) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.AddReplyWithEmotions(postId, parentReplyId, userId, content, emotions, rawEmotions)
+	c.observe("AddReplyWithEmotions", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetReplyChain(postId, replyId string, viewer Viewer) ([]string, error) {
+	start := time.Now()
+	r0, err := c.inner.GetReplyChain(postId, replyId, viewer)
+	c.observe("GetReplyChain", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) AddInfluence(fromUserID, postID, influenceType string) error {
+	start := time.Now()
+	err := c.inner.AddInfluence(fromUserID, postID, influenceType)
+	c.observe("AddInfluence", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetReplies(postId string, viewer Viewer) ([]ReplyItem, error) {
+	start := time.Now()
+	r0, err := c.inner.GetReplies(postId, viewer)
+	c.observe("GetReplies", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetFeed(viewer Viewer, emotionFilter string) ([]FeedPost, error) {
+	start := time.Now()
+	r0, err := c.inner.GetFeed(viewer, emotionFilter)
+	c.observe("GetFeed", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetAllEmotionTags() ([]EmotionTagOnly, error) {
+	start := time.Now()
+	r0, err := c.inner.GetAllEmotionTags()
+	c.observe("GetAllEmotionTags", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetEmotionTagStats(window time.Duration) ([]EmotionTagStats, error) {
+	start := time.Now()
+	r0, err := c.inner.GetEmotionTagStats(window)
+	c.observe("GetEmotionTagStats", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) CorrectPostEmotions(postId, userId string, emotions []EmotionTag) ([]EmotionTag, error) {
+	start := time.Now()
+	r0, err := c.inner.CorrectPostEmotions(postId, userId, emotions)
+	c.observe("CorrectPostEmotions", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetEmotionCorrections(since string, limit int) ([]EmotionCorrection, error) {
+	start := time.Now()
+	r0, err := c.inner.GetEmotionCorrections(since, limit)
+	c.observe("GetEmotionCorrections", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) SyncEmotionTaxonomy(defs []EmotionDefinition) error {
+	start := time.Now()
+	err := c.inner.SyncEmotionTaxonomy(defs)
+	c.observe("SyncEmotionTaxonomy", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) MergeEmotions(from []string, into string) (int, error) {
+	start := time.Now()
+	r0, err := c.inner.MergeEmotions(from, into)
+	c.observe("MergeEmotions", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) FollowUser(userId, targetUserId string) (bool, error) {
+	start := time.Now()
+	r0, err := c.inner.FollowUser(userId, targetUserId)
+	c.observe("FollowUser", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) UnfollowUser(userId, targetUserId string) error {
+	start := time.Now()
+	err := c.inner.UnfollowUser(userId, targetUserId)
+	c.observe("UnfollowUser", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetFollowers(userId string) ([]UserDetails, error) {
+	start := time.Now()
+	r0, err := c.inner.GetFollowers(userId)
+	c.observe("GetFollowers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetFollowing(userId string) ([]UserDetails, error) {
+	start := time.Now()
+	r0, err := c.inner.GetFollowing(userId)
+	c.observe("GetFollowing", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) BlockUser(userId, targetUserId string) error {
+	start := time.Now()
+	err := c.inner.BlockUser(userId, targetUserId)
+	c.observe("BlockUser", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) UnblockUser(userId, targetUserId string) error {
+	start := time.Now()
+	err := c.inner.UnblockUser(userId, targetUserId)
+	c.observe("UnblockUser", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetBlockedUsers(userId string) ([]UserSummary, error) {
+	start := time.Now()
+	r0, err := c.inner.GetBlockedUsers(userId)
+	c.observe("GetBlockedUsers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) MuteUser(userId, targetUserId string) error {
+	start := time.Now()
+	err := c.inner.MuteUser(userId, targetUserId)
+	c.observe("MuteUser", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) UnmuteUser(userId, targetUserId string) error {
+	start := time.Now()
+	err := c.inner.UnmuteUser(userId, targetUserId)
+	c.observe("UnmuteUser", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetMutedUsers(userId string) ([]UserSummary, error) {
+	start := time.Now()
+	r0, err := c.inner.GetMutedUsers(userId)
+	c.observe("GetMutedUsers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetFollowRequests(userId string) ([]UserSummary, error) {
+	start := time.Now()
+	r0, err := c.inner.GetFollowRequests(userId)
+	c.observe("GetFollowRequests", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) ApproveFollowRequest(userId, requesterId string) error {
+	start := time.Now()
+	err := c.inner.ApproveFollowRequest(userId, requesterId)
+	c.observe("ApproveFollowRequest", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) DenyFollowRequest(userId, requesterId string) error {
+	start := time.Now()
+	err := c.inner.DenyFollowRequest(userId, requesterId)
+	c.observe("DenyFollowRequest", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetEmotionFilters(userId string) ([]EmotionFilter, error) {
+	start := time.Now()
+	r0, err := c.inner.GetEmotionFilters(userId)
+	c.observe("GetEmotionFilters", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) SetEmotionFilter(userId string, filter EmotionFilter) error {
+	start := time.Now()
+	err := c.inner.SetEmotionFilter(userId, filter)
+	c.observe("SetEmotionFilter", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) DeleteEmotionFilter(userId, emotion string) error {
+	start := time.Now()
+	err := c.inner.DeleteEmotionFilter(userId, emotion)
+	c.observe("DeleteEmotionFilter", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetPostContent(postId string, viewer Viewer) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.GetPostContent(postId, viewer)
+	c.observe("GetPostContent", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetShareablePostContent(postId, userId string) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.GetShareablePostContent(postId, userId)
+	c.observe("GetShareablePostContent", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetInfluencedPostsLast24Hours(userId string) ([]InfluencedPost, error) {
+	start := time.Now()
+	r0, err := c.inner.GetInfluencedPostsLast24Hours(userId)
+	c.observe("GetInfluencedPostsLast24Hours", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) AddSameTopicRelation(fromPostID, toPostID string) error {
+	start := time.Now()
+	err := c.inner.AddSameTopicRelation(fromPostID, toPostID)
+	c.observe("AddSameTopicRelation", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) GetPostInfluence(postId string, viewer Viewer) (PostInfluence, error) {
+	start := time.Now()
+	r0, err := c.inner.GetPostInfluence(postId, viewer)
+	c.observe("GetPostInfluence", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) CreateUser(username, email, password string) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.CreateUser(username, email, password)
+	c.observe("CreateUser", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetUserByEmail(email string) (AuthUser, error) {
+	start := time.Now()
+	r0, err := c.inner.GetUserByEmail(email)
+	c.observe("GetUserByEmail", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetUserById(userId string) (AuthUser, error) {
+	start := time.Now()
+	r0, err := c.inner.GetUserById(userId)
+	c.observe("GetUserById", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetUserByUsername(username string) (AuthUser, error) {
+	start := time.Now()
+	r0, err := c.inner.GetUserByUsername(username)
+	c.observe("GetUserByUsername", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) ValidateUserCredentials(login, password string) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.ValidateUserCredentials(login, password)
+	c.observe("ValidateUserCredentials", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) CreateAccountToken(userId, purpose, tokenHash string, ttl time.Duration) error {
+	start := time.Now()
+	err := c.inner.CreateAccountToken(userId, purpose, tokenHash, ttl)
+	c.observe("CreateAccountToken", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) ConsumeAccountToken(purpose, tokenHash string) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.ConsumeAccountToken(purpose, tokenHash)
+	c.observe("ConsumeAccountToken", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) MarkEmailVerified(userId string) error {
+	start := time.Now()
+	err := c.inner.MarkEmailVerified(userId)
+	c.observe("MarkEmailVerified", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) UpdatePassword(userId, password string) error {
+	start := time.Now()
+	err := c.inner.UpdatePassword(userId, password)
+	c.observe("UpdatePassword", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) DeleteUser(userId string, purge bool) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.DeleteUser(userId, purge)
+	c.observe("DeleteUser", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) FindPhantomUsers() ([]PhantomUser, error) {
+	start := time.Now()
+	r0, err := c.inner.FindPhantomUsers()
+	c.observe("FindPhantomUsers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) DeletePhantomUsers() (int, error) {
+	start := time.Now()
+	r0, err := c.inner.DeletePhantomUsers()
+	c.observe("DeletePhantomUsers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetUserWithDetails(userId string) (UserDetails, error) {
+	start := time.Now()
+	r0, err := c.inner.GetUserWithDetails(userId)
+	c.observe("GetUserWithDetails", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) UpdateUserProfile(userId string, update ProfileUpdate) error {
+	start := time.Now()
+	err := c.inner.UpdateUserProfile(userId, update)
+	c.observe("UpdateUserProfile", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) SetUserAvatar(userId, key, url string) (string, error) {
+	start := time.Now()
+	r0, err := c.inner.SetUserAvatar(userId, key, url)
+	c.observe("SetUserAvatar", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) SearchUsers(text string, limit int) ([]UserSummary, error) {
+	start := time.Now()
+	r0, err := c.inner.SearchUsers(text, limit)
+	c.observe("SearchUsers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetUserSuggestions(userId string, limit int) ([]UserSuggestion, error) {
+	start := time.Now()
+	r0, err := c.inner.GetUserSuggestions(userId, limit)
+	c.observe("GetUserSuggestions", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetUserPosts(userId string, viewer Viewer) ([]FeedPost, error) {
+	start := time.Now()
+	r0, err := c.inner.GetUserPosts(userId, viewer)
+	c.observe("GetUserPosts", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) CountFollowers(userId string) (int, error) {
+	start := time.Now()
+	r0, err := c.inner.CountFollowers(userId)
+	c.observe("CountFollowers", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) CountFollowing(userId string) (int, error) {
+	start := time.Now()
+	r0, err := c.inner.CountFollowing(userId)
+	c.observe("CountFollowing", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) GetCachedAnalysis(key string) ([]byte, time.Duration, bool, error) {
+	start := time.Now()
+	r0, r1, r2, err := c.inner.GetCachedAnalysis(key)
+	c.observe("GetCachedAnalysis", time.Since(start), err)
+	return r0, r1, r2, err
+}
+
+func (c *instrumentedClient) PutCachedAnalysis(key string, value []byte, ttl time.Duration) error {
+	start := time.Now()
+	err := c.inner.PutCachedAnalysis(key, value, ttl)
+	c.observe("PutCachedAnalysis", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) DeleteExpiredCachedAnalyses() (int, error) {
+	start := time.Now()
+	r0, err := c.inner.DeleteExpiredCachedAnalyses()
+	c.observe("DeleteExpiredCachedAnalyses", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) Search(query SearchQuery) (SearchResult, error) {
+	start := time.Now()
+	r0, err := c.inner.Search(query)
+	c.observe("Search", time.Since(start), err)
+	return r0, err
+}
+
+func (c *instrumentedClient) EnsureSchema() error {
+	start := time.Now()
+	err := c.inner.EnsureSchema()
+	c.observe("EnsureSchema", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) VerifyConnectivity(ctx context.Context) error {
+	start := time.Now()
+	err := c.inner.VerifyConnectivity(ctx)
+	c.observe("VerifyConnectivity", time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedClient) Close() error {
+	return c.inner.Close()
+}
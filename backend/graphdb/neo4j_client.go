@@ -1,10 +1,18 @@
 package graphdb
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
 	"github.com/google/uuid"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"golang.org/x/crypto/bcrypt"
@@ -14,40 +22,297 @@ type Neo4jClient struct {
 	driver neo4j.DriverWithContext
 }
 
-func NewNeo4jClient(uri, username, password string) (GraphDbClient, error) {
-	driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(username, password, ""))
+func NewNeo4jClient(cfg config.Neo4j) (GraphDbClient, error) {
+	driver, err := neo4j.NewDriverWithContext(cfg.URI, neo4j.BasicAuth(cfg.Username, cfg.Password, ""))
 	if err != nil {
 		return nil, err
 	}
 	return &Neo4jClient{driver: driver}, nil
 }
 
+// VerifyConnectivity checks that the database is reachable with our credentials
+func (c *Neo4jClient) VerifyConnectivity(ctx context.Context) error {
+	return c.driver.VerifyConnectivity(ctx)
+}
+
+const usernameLowerConstraint = "CREATE CONSTRAINT userUsernameLower IF NOT EXISTS FOR (u:User) REQUIRE u.usernameLower IS UNIQUE"
+
+// schemaStatements are idempotent and run at startup by EnsureSchema
+var schemaStatements = []string{
+	// 投稿の大半が日本語なので、CJKアナライザ（バイグラム）で索引する
+	"CREATE FULLTEXT INDEX contentSearch IF NOT EXISTS FOR (n:Post|Reply) ON EACH [n.content] " +
+		"OPTIONS {indexConfig: {`fulltext.analyzer`: 'cjk'}}",
+	// Usernames are unique regardless of case. Backfill the lowercased copy for
+	// users created before it existed; existing users whose names differ only
+	// in case must be renamed before the constraint can be created.
+	"MATCH (u:User) WHERE u.usernameLower IS NULL SET u.usernameLower = toLower(u.username)",
+	usernameLowerConstraint,
+	"CREATE INDEX accountTokenHash IF NOT EXISTS FOR (t:AccountToken) ON (t.hash)",
+	"CREATE INDEX accountTokenExpiry IF NOT EXISTS FOR (t:AccountToken) ON (t.expiresAt)",
+	"CREATE FULLTEXT INDEX userSearch IF NOT EXISTS FOR (u:User) ON EACH [u.username, u.displayName] " +
+		"OPTIONS {indexConfig: {`fulltext.analyzer`: 'cjk'}}",
+	"CREATE CONSTRAINT analysisCacheKey IF NOT EXISTS FOR (a:AnalysisCache) REQUIRE a.key IS UNIQUE",
+	"CREATE INDEX analysisCacheExpiry IF NOT EXISTS FOR (a:AnalysisCache) ON (a.expiresAt)",
+	// Suggestions only compare emotions of recent posts and replies
+	"CREATE INDEX postCreatedAt IF NOT EXISTS FOR (p:Post) ON (p.createdAt)",
+	"CREATE INDEX replyCreatedAt IF NOT EXISTS FOR (r:Reply) ON (r.createdAt)",
+}
+
+// EnsureSchema runs every statement even when an earlier one fails, so one
+// bad constraint can't leave unrelated indexes missing
+func (c *Neo4jClient) EnsureSchema() error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	var errs []error
+	// Schema changes can't share a transaction with each other
+	for _, stmt := range schemaStatements {
+		if stmt == usernameLowerConstraint {
+			if err := checkUsernamesDifferInCase(session); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+			_, err := tx.Run(context.Background(), stmt, nil)
+			return nil, err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schema statement %q: %w", stmt, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkUsernamesDifferInCase fails, naming the users involved, when existing
+// usernames differ only in case and so would break userUsernameLower
+func checkUsernamesDifferInCase(session neo4j.SessionWithContext) error {
+	duplicates, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User)
+			WITH u.usernameLower AS name, collect(u.username + ' (' + u.id + ')') AS users
+			WHERE size(users) > 1
+			RETURN users
+			ORDER BY name
+		`, nil)
+		if err != nil {
+			return nil, err
+		}
+		var duplicates []string
+		for result.Next(context.Background()) {
+			users, _ := result.Record().Get("users")
+			var names []string
+			for _, u := range users.([]any) {
+				names = append(names, u.(string))
+			}
+			duplicates = append(duplicates, strings.Join(names, ", "))
+		}
+		return duplicates, result.Err()
+	})
+	if err != nil {
+		return err
+	}
+	if dups := duplicates.([]string); len(dups) > 0 {
+		return fmt.Errorf("skipped userUsernameLower: rename all but one user in each group whose usernames differ only in case: %s", strings.Join(dups, "; "))
+	}
+	return nil
+}
+
+// viewerParams adds the parameters queries use to hide content from a viewer:
+// $viewerId for blocks and mutes, and $filterUserId and $now for emotion
+// filters. $filterUserId is empty when the viewer asked to see filtered
+// content, so the filter pattern never matches.
+func viewerParams(viewer Viewer, params map[string]any) map[string]any {
+	params["viewerId"] = viewer.ID
+	params["filterUserId"] = viewer.ID
+	if viewer.ShowFiltered {
+		params["filterUserId"] = ""
+	}
+	params["now"] = time.Now().UTC().Format(time.RFC3339)
+	return params
+}
+
+// visiblePost is a Cypher predicate on whether $viewerId may read post,
+// written by author. Authors see all their posts, followers see everything
+// but private posts, and anyone else only sees public posts by public
+// accounts. Posts from before visibility existed are public. Blocks hide
+// posts both ways, whatever their visibility.
+func visiblePost(author, post string) string {
+	return `(NOT EXISTS { (` + author + `)-[:BLOCKS]-(:User {id: $viewerId}) }
+		AND (` + author + `.id = $viewerId
+		OR coalesce(` + post + `.visibility, 'public') = 'public' AND coalesce(` + author + `.private, false) = false
+		OR coalesce(` + post + `.visibility, 'public') <> 'private' AND EXISTS { (:User {id: $viewerId})-[:FOLLOWS]->(` + author + `) }))`
+}
+
+// requireShareablePost fails with a *NotFoundError unless userId can see the
+// post, and with ErrNotShareable unless everyone can
+func requireShareablePost(tx neo4j.ManagedTransaction, userId, postId string) error {
+	if err := requireVisiblePost(tx, userId, postId); err != nil {
+		return err
+	}
+	result, err := tx.Run(context.Background(), `
+		MATCH (author:User)-[:POSTED]->(p:Post {id: $postId})
+		WHERE coalesce(p.visibility, 'public') <> 'public' OR coalesce(author.private, false)
+		RETURN p.id
+	`, map[string]any{"postId": postId})
+	if err != nil {
+		return err
+	}
+	if result.Next(context.Background()) {
+		return ErrNotShareable
+	}
+	return result.Err()
+}
+
+// requireUser fails with a *NotFoundError unless userId belongs to a
+// registered user that hasn't deleted their account. Writes MATCH their users
+// rather than MERGE them, so this is what tells a bad ID apart from a no-op.
+func requireUser(tx neo4j.ManagedTransaction, userId string) error {
+	return requireNode(tx, "user", userId, `
+		MATCH (u:User {id: $id})
+		WHERE u.username IS NOT NULL AND u.deletedAt IS NULL
+		RETURN u.id
+	`)
+}
+
+// requireVisiblePost fails with a *NotFoundError unless the post exists and
+// userId may read it. That includes posts hidden by a block, so writes check
+// requireNotBlockedByAuthor first to answer ErrBlocked instead.
+func requireVisiblePost(tx neo4j.ManagedTransaction, userId, postId string) error {
+	result, err := tx.Run(context.Background(), `
+		MATCH (author:User)-[:POSTED]->(p:Post {id: $postId})
+		WHERE `+visiblePost("author", "p")+`
+		RETURN p.id
+	`, map[string]any{"postId": postId, "viewerId": userId})
+	if err != nil {
+		return err
+	}
+	if !result.Next(context.Background()) {
+		return &NotFoundError{Kind: "post", ID: postId}
+	}
+	return result.Err()
+}
+
+// requireNotBlocked fails with ErrBlocked if either user has blocked the other
+func requireNotBlocked(tx neo4j.ManagedTransaction, userId, otherUserId string) error {
+	return requireNoMatch(tx, `
+		MATCH (:User {id: $userId})-[b:BLOCKS]-(:User {id: $otherUserId})
+		RETURN b
+	`, map[string]any{"userId": userId, "otherUserId": otherUserId})
+}
+
+// requireReplyInThread fails with a *NotFoundError unless the reply belongs
+// to the post's reply thread, at any depth
+func requireReplyInThread(tx neo4j.ManagedTransaction, postId, replyId string) error {
+	result, err := tx.Run(context.Background(), `
+		MATCH (r:Reply {id: $replyId})-[:REPLY_TO*]->(:Post {id: $postId})
+		RETURN r.id
+		LIMIT 1
+	`, map[string]any{"postId": postId, "replyId": replyId})
+	if err != nil {
+		return err
+	}
+	if !result.Next(context.Background()) {
+		return &NotFoundError{Kind: "reply", ID: replyId}
+	}
+	return result.Err()
+}
+
+// requireNotBlockedByReplier fails with ErrBlocked if the user and the
+// reply's author have blocked one another
+func requireNotBlockedByReplier(tx neo4j.ManagedTransaction, userId, replyId string) error {
+	return requireNoMatch(tx, `
+		MATCH (:User {id: $userId})-[b:BLOCKS]-(:User)-[:REPLIED]->(:Reply {id: $replyId})
+		RETURN b
+	`, map[string]any{"userId": userId, "replyId": replyId})
+}
+
+// requireNotBlockedByAuthor fails with ErrBlocked if the user and the post's
+// author have blocked one another
+func requireNotBlockedByAuthor(tx neo4j.ManagedTransaction, userId, postId string) error {
+	return requireNoMatch(tx, `
+		MATCH (:User {id: $userId})-[b:BLOCKS]-(:User)-[:POSTED]->(:Post {id: $postId})
+		RETURN b
+	`, map[string]any{"userId": userId, "postId": postId})
+}
+
+func requireNoMatch(tx neo4j.ManagedTransaction, query string, params map[string]any) error {
+	result, err := tx.Run(context.Background(), query, params)
+	if err != nil {
+		return err
+	}
+	if result.Next(context.Background()) {
+		return ErrBlocked
+	}
+	return result.Err()
+}
+
+func requireNode(tx neo4j.ManagedTransaction, kind, id, query string) error {
+	result, err := tx.Run(context.Background(), query, map[string]any{"id": id})
+	if err != nil {
+		return err
+	}
+	if !result.Next(context.Background()) {
+		return &NotFoundError{Kind: kind, ID: id}
+	}
+	return result.Err()
+}
+
 func (c *Neo4jClient) Close() error {
 	return c.driver.Close(context.Background())
 }
 
-func (c *Neo4jClient) CreatePostWithEmotions(userId, postId, content string, emotions []EmotionTag) error {
+func (c *Neo4jClient) CreatePostWithEmotions(userId, postId, content, visibility, quotedPostId string, emotions, rawEmotions []EmotionTag) error {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	createdAt := time.Now().UTC().Format(time.RFC3339)
+	raw, err := json.Marshal(rawEmotions)
+	if err != nil {
+		return err
+	}
 
-	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
-		// UserとPostノードの作成
+	_, err = session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if quotedPostId != "" {
+			if err := requireNotBlockedByAuthor(tx, userId, quotedPostId); err != nil {
+				return nil, err
+			}
+			if err := requireShareablePost(tx, userId, quotedPostId); err != nil {
+				return nil, err
+			}
+		}
+
+		// Postノードの作成
 		_, err := tx.Run(context.Background(), `
-            MERGE (u:User {id: $userId})
-            CREATE (p:Post {id: $postId, content: $content, createdAt: $createdAt})
+            MATCH (u:User {id: $userId})
+            CREATE (p:Post {id: $postId, content: $content, visibility: $visibility, createdAt: $createdAt, rawEmotions: $rawEmotions})
             MERGE (u)-[:POSTED]->(p)
         `, map[string]any{
-			"userId":    userId,
-			"postId":    postId,
-			"content":   content,
-			"createdAt": createdAt,
+			"userId":      userId,
+			"postId":      postId,
+			"content":     content,
+			"visibility":  visibility,
+			"createdAt":   createdAt,
+			"rawEmotions": string(raw),
 		})
 		if err != nil {
 			return nil, err
 		}
 
+		if quotedPostId != "" {
+			_, err := tx.Run(context.Background(), `
+				MATCH (p:Post {id: $postId})
+				MATCH (quoted:Post {id: $quotedPostId})
+				MERGE (p)-[:QUOTES]->(quoted)
+			`, map[string]any{"postId": postId, "quotedPostId": quotedPostId})
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		// 各Emotionとのリレーション（スコアはリレーションプロパティ）
 		for _, e := range emotions {
 			_, err := tx.Run(context.Background(), `
@@ -55,7 +320,7 @@ func (c *Neo4jClient) CreatePostWithEmotions(userId, postId, content string, emo
 				WITH em
                 MATCH (p:Post {id: $postId})
                 MERGE (em)-[r:TAGGED]->(p)
-                SET r.score = $score
+                SET r.score = $score, r.source = 'model'
             `, map[string]any{
 				"type":   e.Type,
 				"score":  e.Score,
@@ -72,20 +337,55 @@ func (c *Neo4jClient) CreatePostWithEmotions(userId, postId, content string, emo
 	return err
 }
 
-func (c *Neo4jClient) GetPostWithEmotions(postId string) (string, string, string, []EmotionTag, error) {
+func (c *Neo4jClient) Repost(postId, userId string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlockedByAuthor(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		if err := requireShareablePost(tx, userId, postId); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			MATCH (p:Post {id: $postId})
+			MERGE (u)-[r:REPOSTED]->(p)
+			ON CREATE SET r.createdAt = $createdAt
+		`, map[string]any{
+			"userId":    userId,
+			"postId":    postId,
+			"createdAt": createdAt,
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+func (c *Neo4jClient) GetPostWithEmotions(postId string, viewer Viewer) (string, string, string, string, []EmotionTag, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		rec, err := tx.Run(context.Background(), `
 			MATCH (u:User)-[:POSTED]->(p:Post {id: $postId})
+			WHERE `+visiblePost("u", "p")+`
 			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
 			RETURN 
 				u.id AS userId,
 				p.content AS content,
 				p.createdAt AS createdAt,
-				collect({type: e.type, score: t.score}) AS emotions
-		`, map[string]any{"postId": postId})
+				coalesce(p.visibility, 'public') AS visibility,
+				collect({type: e.type, score: t.score, source: t.source}) AS emotions
+		`, map[string]any{"postId": postId, "viewerId": viewer.ID})
 
 		if err != nil {
 			return nil, err
@@ -98,46 +398,65 @@ func (c *Neo4jClient) GetPostWithEmotions(postId string) (string, string, string
 		userId, _ := record.Get("userId")
 		content, _ := record.Get("content")
 		createdAt, _ := record.Get("createdAt") // ← 追加
+		visibility, _ := record.Get("visibility")
 		rawEmotions, _ := record.Get("emotions")
 
-		var emotions []EmotionTag
-		if list, ok := rawEmotions.([]any); ok {
-			for _, item := range list {
-				if m, ok := item.(map[string]any); ok {
-					emotions = append(emotions, EmotionTag{
-						Type:  m["type"].(string),
-						Score: m["score"].(float64),
-					})
-				}
-			}
-		}
+		emotions := emotionTagsFrom(rawEmotions)
 
 		return struct {
-			UserID    string
-			Content   string
-			CreatedAt string
-			Emotions  []EmotionTag
+			UserID     string
+			Content    string
+			CreatedAt  string
+			Visibility string
+			Emotions   []EmotionTag
 		}{
-			UserID:    userId.(string),
-			Content:   content.(string),
-			CreatedAt: createdAt.(string), // ← panicしやすいので、必要なら型チェックしてもOK
-			Emotions:  emotions,
+			UserID:     userId.(string),
+			Content:    content.(string),
+			CreatedAt:  createdAt.(string), // ← panicしやすいので、必要なら型チェックしてもOK
+			Visibility: visibility.(string),
+			Emotions:   emotions,
 		}, nil
 
 	})
 	if err != nil {
-		return "", "", "", nil, err
+		return "", "", "", "", nil, err
 	}
 	if result == nil {
-		return "", "", "", nil, nil // Not found
+		return "", "", "", "", nil, nil // Not found
 	}
 	r := result.(struct {
-		UserID    string
-		Content   string
-		CreatedAt string
-		Emotions  []EmotionTag
+		UserID     string
+		Content    string
+		CreatedAt  string
+		Visibility string
+		Emotions   []EmotionTag
 	})
-	return r.UserID, r.Content, r.CreatedAt, r.Emotions, nil
+	return r.UserID, r.Content, r.CreatedAt, r.Visibility, r.Emotions, nil
+}
+
+// emotionTagsFrom converts a collected list of {type, score, source} maps.
+// OPTIONAL MATCH on an untagged node yields one entry with a null type, which
+// is skipped. Tags without a source predate corrections and come from the model.
+func emotionTagsFrom(raw any) []EmotionTag {
+	list, _ := raw.([]any)
+	var tags []EmotionTag
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		etype, ok := m["type"].(string)
+		if !ok {
+			continue
+		}
+		score, _ := m["score"].(float64)
+		source, _ := m["source"].(string)
+		if source == "" {
+			source = TagSourceModel
+		}
+		tags = append(tags, EmotionTag{Type: etype, Score: score, Source: source})
+	}
+	return tags
 }
 
 func (c *Neo4jClient) GetReactions(postId string) (map[string]int, error) {
@@ -178,9 +497,18 @@ func (c *Neo4jClient) AddReaction(postId, userId, reactionType string) error {
 	createdAt := time.Now().UTC().Format(time.RFC3339)
 
 	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlockedByAuthor(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		if err := requireVisiblePost(tx, userId, postId); err != nil {
+			return nil, err
+		}
+
 		_, err := tx.Run(context.Background(), `
-            MERGE (u:User {id: $userId})
-			WITH u
+            MATCH (u:User {id: $userId})
             MATCH (p:Post {id: $postId})
             MERGE (u)-[r:REACTED {type: $type}]->(p)
 			SET r.createdAt = $createdAt
@@ -196,29 +524,94 @@ func (c *Neo4jClient) AddReaction(postId, userId, reactionType string) error {
 	return err
 }
 
-func (c *Neo4jClient) AddReplyWithEmotions(postId, userId, content string, emotions []EmotionTag) (string, error) {
+func (c *Neo4jClient) AddReplyReaction(postId, replyId, userId, reactionType string) error {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
-	replyId := uuid.New().String()
 	createdAt := time.Now().UTC().Format(time.RFC3339)
 
 	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
-		// User、Post、Replyノードと関係の作成
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlockedByAuthor(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		if err := requireVisiblePost(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		if err := requireReplyInThread(tx, postId, replyId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlockedByReplier(tx, userId, replyId); err != nil {
+			return nil, err
+		}
+
 		_, err := tx.Run(context.Background(), `
-			MERGE (u:User {id: $userId})
-			WITH u
-			MATCH (p:Post {id: $postId})
-			CREATE (r:Reply {id: $replyId, content: $content, createdAt: $createdAt})
-			MERGE (u)-[:REPLIED]->(r)
-			MERGE (r)-[:REPLY_TO]->(p)
+			MATCH (u:User {id: $userId})
+			MATCH (r:Reply {id: $replyId})
+			MERGE (u)-[x:REACTED {type: $type}]->(r)
+			SET x.createdAt = $createdAt
 		`, map[string]any{
 			"userId":    userId,
-			"postId":    postId,
 			"replyId":   replyId,
-			"content":   content,
+			"type":      reactionType,
 			"createdAt": createdAt,
 		})
+		return nil, err
+	})
+
+	return err
+}
+
+func (c *Neo4jClient) AddReplyWithEmotions(postId, parentReplyId, userId, content string, emotions, rawEmotions []EmotionTag) (string, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	replyId := uuid.New().String()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	raw, err := json.Marshal(rawEmotions)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlockedByAuthor(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		if err := requireVisiblePost(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		parent := `MATCH (parent:Post {id: $postId})`
+		if parentReplyId != "" {
+			if err := requireReplyInThread(tx, postId, parentReplyId); err != nil {
+				return nil, err
+			}
+			if err := requireNotBlockedByReplier(tx, userId, parentReplyId); err != nil {
+				return nil, err
+			}
+			parent = `MATCH (parent:Reply {id: $parentReplyId})`
+		}
+
+		// Replyノードと関係の作成
+		_, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			`+parent+`
+			CREATE (r:Reply {id: $replyId, content: $content, createdAt: $createdAt, rawEmotions: $rawEmotions})
+			MERGE (u)-[:REPLIED]->(r)
+			MERGE (r)-[:REPLY_TO]->(parent)
+		`, map[string]any{
+			"userId":        userId,
+			"postId":        postId,
+			"parentReplyId": parentReplyId,
+			"replyId":       replyId,
+			"content":       content,
+			"createdAt":     createdAt,
+			"rawEmotions":   string(raw),
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -230,7 +623,7 @@ func (c *Neo4jClient) AddReplyWithEmotions(postId, userId, content string, emoti
 				WITH em
 				MATCH (r:Reply {id: $replyId})
 				MERGE (em)-[tag:TAGGED]->(r)
-				SET tag.score = $score
+				SET tag.score = $score, tag.source = 'model'
 			`, map[string]any{
 				"type":    e.Type,
 				"score":   e.Score,
@@ -271,23 +664,36 @@ func (c *Neo4jClient) AddInfluence(fromUserID, postID, influenceType string) err
 	return err
 }
 
-func (c *Neo4jClient) GetReplies(postId string) ([]ReplyItem, error) {
+func (c *Neo4jClient) GetReplies(postId string, viewer Viewer) ([]ReplyItem, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireVisiblePost(tx, viewer.ID, postId); err != nil {
+			return nil, err
+		}
 		records, err := tx.Run(context.Background(), `
-			MATCH (u:User)-[:REPLIED]->(r:Reply)-[:REPLY_TO]->(p:Post {id: $postId})
+			MATCH (u:User)-[:REPLIED]->(r:Reply)-[:REPLY_TO*]->(:Post {id: $postId})
+			WHERE NOT EXISTS { (u)-[:BLOCKS]-(:User {id: $viewerId}) }
+			  AND NOT EXISTS {
+				MATCH (:User {id: $filterUserId})-[f:FILTERS]->(:Emotion)<-[:PARENT*0..]-(:Emotion)-[t:TAGGED]->(r)
+				WHERE t.score >= f.minScore AND (f.until IS NULL OR f.until > $now)
+			  }
+			OPTIONAL MATCH (r)-[:REPLY_TO]->(parent:Reply)
 			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(r)
-			WITH r, u, collect(DISTINCT {type: e.type, score: t.score}) AS emotions
+			WITH r, u, parent, collect(DISTINCT {type: e.type, score: t.score, source: t.source}) AS emotions
+			OPTIONAL MATCH (:User)-[x:REACTED]->(r)
+			WITH r, u, parent, emotions, collect(x.type) AS reactions
 			RETURN 
 				r.id AS replyId,
 				u.id AS userId,
 				r.content AS content,
 				r.createdAt AS createdAt,
-				emotions
+				emotions,
+				parent.id AS parentReplyId,
+				reactions
 			ORDER BY r.createdAt ASC
-		`, map[string]any{"postId": postId})
+		`, viewerParams(viewer, map[string]any{"postId": postId}))
 		if err != nil {
 			return nil, err
 		}
@@ -299,21 +705,22 @@ func (c *Neo4jClient) GetReplies(postId string) ([]ReplyItem, error) {
 			// パース
 			emotionList := []EmotionTag{}
 			if raw, ok := rec.Get("emotions"); ok && raw != nil {
-				for _, e := range raw.([]any) {
-					emap := e.(map[string]any)
-					emotionList = append(emotionList, EmotionTag{
-						Type:  emap["type"].(string),
-						Score: emap["score"].(float64),
-					})
-				}
+				emotionList = append(emotionList, emotionTagsFrom(raw)...)
+			}
+			parentReplyId, _ := rec.Values[5].(string)
+			reactions := map[string]int{}
+			for _, t := range rec.Values[6].([]any) {
+				reactions[t.(string)]++
 			}
 
 			replies = append(replies, ReplyItem{
-				ReplyID:     rec.Values[0].(string),
-				UserID:      rec.Values[1].(string),
-				Content:     rec.Values[2].(string),
-				CreatedAt:   rec.Values[3].(string),
-				EmotionTags: emotionList,
+				ReplyID:       rec.Values[0].(string),
+				UserID:        rec.Values[1].(string),
+				Content:       rec.Values[2].(string),
+				CreatedAt:     rec.Values[3].(string),
+				EmotionTags:   emotionList,
+				ParentReplyID: parentReplyId,
+				Reactions:     reactions,
 			})
 		}
 
@@ -321,7 +728,7 @@ func (c *Neo4jClient) GetReplies(postId string) ([]ReplyItem, error) {
 			return nil, err
 		}
 
-		return replies, nil
+		return threadReplies(replies), nil
 	})
 
 	if err != nil {
@@ -330,120 +737,193 @@ func (c *Neo4jClient) GetReplies(postId string) ([]ReplyItem, error) {
 	return result.([]ReplyItem), nil
 }
 
-func (c *Neo4jClient) GetFeed(emotionFilter string) ([]FeedPost, error) {
-	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
-	defer session.Close(context.Background())
-
-	var query string
-	params := map[string]any{}
-	if emotionFilter != "" {
-		query = `
-			MATCH (p:Post)<-[:TAGGED]-(e:Emotion)
-			WHERE e.type = $emotion
-			WITH DISTINCT p
-			MATCH (u:User)-[:POSTED]->(p)
-
-			OPTIONAL MATCH (e2:Emotion)-[tag:TAGGED]->(p)
-			WITH p, u, collect(DISTINCT {type: e2.type, score: tag.score}) AS emotions
-
-			OPTIONAL MATCH (reactor:User)-[r:REACTED]->(p)
-			WITH p, u, emotions, collect({type: r.type}) AS reactions
-
-			OPTIONAL MATCH (replier:User)-[:REPLIED]->(reply:Reply)-[:REPLY_TO]->(p)
-			WITH p, u, emotions, reactions, count(DISTINCT reply) AS replyCount
-
-			RETURN 
-				p.id AS postId,
-				p.content AS content,
-				u.id AS userId,
-				p.createdAt AS createdAt,
-				emotions,
-				reactions,
-				replyCount
-			ORDER BY p.createdAt DESC
-
-		`
-		params["emotion"] = emotionFilter
-	} else {
-		query = `
-			MATCH (u:User)-[:POSTED]->(p:Post)
-
-			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
-			WITH u, p, collect(DISTINCT {type: e.type, score: t.score}) AS emotions
-
-			OPTIONAL MATCH (reactor:User)-[r:REACTED]->(p)
-			WITH u, p, emotions, collect({type: r.type}) AS reactions
-
-			OPTIONAL MATCH (replier:User)-[:REPLIED]->(reply:Reply)-[:REPLY_TO]->(p)
-			WITH u, p, emotions, reactions, count(DISTINCT reply) AS replyCount
+// threadReplies orders replies (oldest first) so every reply directly follows
+// its parent, filling in Depth and ChildCount. Replies under a hidden reply
+// are hidden with it.
+func threadReplies(replies []ReplyItem) []ReplyItem {
+	children := map[string][]ReplyItem{}
+	for _, r := range replies {
+		children[r.ParentReplyID] = append(children[r.ParentReplyID], r)
+	}
 
-			RETURN 
-				p.id AS postId,
-				p.content AS content,
-				u.id AS userId,
-				p.createdAt AS createdAt,
-				emotions,
-				reactions,
-				replyCount
-			ORDER BY p.createdAt DESC
-		`
+	threaded := []ReplyItem{}
+	var walk func(parentId string, depth int)
+	walk = func(parentId string, depth int) {
+		for _, r := range children[parentId] {
+			r.Depth = depth
+			r.ChildCount = len(children[r.ReplyID])
+			threaded = append(threaded, r)
+			walk(r.ReplyID, depth+1)
+		}
 	}
+	walk("", 0)
+	return threaded
+}
+
+// GetReplyChain returns the content of a reply and the replies above it,
+// starting from the one directly under the post
+func (c *Neo4jClient) GetReplyChain(postId, replyId string, viewer Viewer) ([]string, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
-		records, err := tx.Run(context.Background(), query, params)
-		if err != nil {
+		if err := requireNotBlockedByAuthor(tx, viewer.ID, postId); err != nil {
+			return nil, err
+		}
+		if err := requireVisiblePost(tx, viewer.ID, postId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlockedByReplier(tx, viewer.ID, replyId); err != nil {
+			return nil, err
+		}
+		if err := requireReplyInThread(tx, postId, replyId); err != nil {
 			return nil, err
 		}
 
-		var posts []FeedPost
-		for records.Next(context.Background()) {
-			rec := records.Record()
-
-			// emotionTags
-			emotionsRaw := rec.Values[4].([]any)
-			var emotions []EmotionTag
-			for _, e := range emotionsRaw {
-				if m, ok := e.(map[string]any); ok {
-					emotions = append(emotions, EmotionTag{
-						Type:  m["type"].(string),
-						Score: m["score"].(float64),
-					})
-				}
-			}
-
-			// reactions
-			reactionsRaw := rec.Values[5].([]any)
-			reactionCounts := map[string]int{}
-			for _, r := range reactionsRaw {
-				if m, ok := r.(map[string]any); ok {
-					if reactionType, ok := m["type"].(string); ok && reactionType != "" {
-						reactionCounts[reactionType]++
-					}
-				}
+		// Leave out ancestors the viewer can't see in GetReplies, so their
+		// content never reaches the emotion service
+		records, err := tx.Run(context.Background(), `
+			MATCH path = (:Reply {id: $replyId})-[:REPLY_TO*]->(:Post {id: $postId})
+			WITH reverse(nodes(path))[1..] AS replies
+			LIMIT 1
+			UNWIND range(0, size(replies) - 1) AS i
+			WITH replies[i] AS r, i
+			MATCH (u:User)-[:REPLIED]->(r)
+			WHERE NOT EXISTS { (u)-[:BLOCKS]-(:User {id: $viewerId}) }
+			WITH r ORDER BY i
+			RETURN collect(r.content) AS chain
+		`, map[string]any{"postId": postId, "replyId": replyId, "viewerId": viewer.ID})
+		if err != nil {
+			return nil, err
+		}
+		var chain []string
+		if records.Next(context.Background()) {
+			for _, content := range records.Record().Values[0].([]any) {
+				chain = append(chain, content.(string))
 			}
-
-			// reply count
-			replyCount := int(rec.Values[6].(int64))
-
-			posts = append(posts, FeedPost{
-				PostID:      rec.Values[0].(string),
-				Content:     rec.Values[1].(string),
-				UserID:      rec.Values[2].(string),
-				CreatedAt:   rec.Values[3].(string),
-				EmotionTags: emotions,
-				Reactions:   reactionCounts,
-				ReplyCount:  replyCount,
-			})
 		}
-		return posts, nil
+		return chain, records.Err()
 	})
 	if err != nil {
 		return nil, err
 	}
-	return result.([]FeedPost), nil
+	return result.([]string), nil
 }
 
-func (c *Neo4jClient) GetAllEmotionTags() ([]EmotionTagOnly, error) {
+func (c *Neo4jClient) GetFeed(viewer Viewer, emotionFilter string) ([]FeedPost, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	params := viewerParams(viewer, map[string]any{"emotion": emotionFilter})
+	query := `
+		CALL {
+			MATCH (u:User)-[:POSTED]->(p:Post)
+			RETURN u, p, null AS reposter, p.createdAt AS sharedAt
+			UNION
+			// Reposts by users the viewer follows show the post again
+			MATCH (:User {id: $viewerId})-[:FOLLOWS]->(reposter:User)-[rp:REPOSTED]->(p:Post)<-[:POSTED]-(u:User)
+			WHERE NOT EXISTS { (:User {id: $viewerId})-[:MUTES]->(reposter) }
+			RETURN u, p, reposter, rp.createdAt AS sharedAt
+		}
+		WITH u, p, reposter, sharedAt
+		WHERE ($emotion = '' OR EXISTS { MATCH (:Emotion {type: $emotion})-[:TAGGED]->(p) })
+		  AND NOT EXISTS { (:User {id: $viewerId})-[:MUTES]->(u) }
+		  AND ` + visiblePost("u", "p") + `
+		  AND NOT EXISTS {
+			MATCH (:User {id: $filterUserId})-[f:FILTERS]->(:Emotion)<-[:PARENT*0..]-(:Emotion)-[t:TAGGED]->(p)
+			WHERE t.score >= f.minScore AND (f.until IS NULL OR f.until > $now)
+		  }
+
+		OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
+		WITH u, p, reposter, sharedAt, collect(DISTINCT {type: e.type, score: t.score, source: t.source}) AS emotions
+
+		OPTIONAL MATCH (reactor:User)-[r:REACTED]->(p)
+		WITH u, p, reposter, sharedAt, emotions, collect({type: r.type}) AS reactions
+
+		OPTIONAL MATCH (replier:User)-[:REPLIED]->(reply:Reply)-[:REPLY_TO*]->(p)
+		WITH u, p, reposter, sharedAt, emotions, reactions, count(DISTINCT reply) AS replyCount
+
+		OPTIONAL MATCH (p)-[:QUOTES]->(quoted:Post)
+		RETURN 
+			p.id AS postId,
+			p.content AS content,
+			u.id AS userId,
+			p.createdAt AS createdAt,
+			emotions,
+			reactions,
+			replyCount,
+			coalesce(p.visibility, 'public') AS visibility,
+			COUNT { (:User)-[:REPOSTED]->(p) } AS repostCount,
+			COUNT { (:Post)-[:QUOTES]->(p) } AS quoteCount,
+			quoted.id AS quotedPostId,
+			reposter.id AS repostedBy,
+			CASE WHEN reposter IS NULL THEN null ELSE sharedAt END AS repostedAt
+		ORDER BY sharedAt DESC
+	`
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), query, params)
+		if err != nil {
+			return nil, err
+		}
+
+		var posts []FeedPost
+		for records.Next(context.Background()) {
+			posts = append(posts, feedPostFrom(records.Record()))
+		}
+		return posts, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]FeedPost), nil
+}
+
+// feedPostFrom reads a post returned by the feed or a post listing. Queries
+// not returning repostedBy and repostedAt leave them empty.
+func feedPostFrom(record *neo4j.Record) FeedPost {
+	postId, _ := record.Get("postId")
+	content, _ := record.Get("content")
+	userId, _ := record.Get("userId")
+	createdAt, _ := record.Get("createdAt")
+	emotions, _ := record.Get("emotions")
+	reactions, _ := record.Get("reactions")
+	replyCount, _ := record.Get("replyCount")
+	visibility, _ := record.Get("visibility")
+	repostCount, _ := record.Get("repostCount")
+	quoteCount, _ := record.Get("quoteCount")
+	quotedPostId, _ := record.Get("quotedPostId")
+	repostedBy, _ := record.Get("repostedBy")
+	repostedAt, _ := record.Get("repostedAt")
+
+	reactionCounts := map[string]int{}
+	for _, r := range reactions.([]any) {
+		if m, ok := r.(map[string]any); ok {
+			if reactionType, ok := m["type"].(string); ok && reactionType != "" {
+				reactionCounts[reactionType]++
+			}
+		}
+	}
+
+	post := FeedPost{
+		PostID:      postId.(string),
+		Content:     content.(string),
+		UserID:      userId.(string),
+		CreatedAt:   createdAt.(string),
+		EmotionTags: emotionTagsFrom(emotions),
+		Reactions:   reactionCounts,
+		ReplyCount:  int(replyCount.(int64)),
+		Visibility:  visibility.(string),
+		RepostCount: int(repostCount.(int64)),
+		QuoteCount:  int(quoteCount.(int64)),
+	}
+	post.QuotedPostID, _ = quotedPostId.(string)
+	post.RepostedBy, _ = repostedBy.(string)
+	post.RepostedAt, _ = repostedAt.(string)
+	return post
+}
+
+func (c *Neo4jClient) GetAllEmotionTags() ([]EmotionTagOnly, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
@@ -476,25 +956,487 @@ func (c *Neo4jClient) GetAllEmotionTags() ([]EmotionTagOnly, error) {
 	return result.([]EmotionTagOnly), nil
 }
 
-func (c *Neo4jClient) FollowUser(userId, targetUserId string) error {
+// GetEmotionTagStats returns usage statistics for every Emotion node
+func (c *Neo4jClient) GetEmotionTagStats(window time.Duration) ([]EmotionTagStats, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
-	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
-		_, err := tx.Run(context.Background(), `
-			MERGE (u1:User {id: $userId})
-			MERGE (u2:User {id: $targetUserId})
-			MERGE (u1)-[:FOLLOWS]->(u2)
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			WITH datetime() - duration({seconds: $windowSeconds}) AS recentStart,
+			     datetime() - duration({seconds: 2 * $windowSeconds}) AS previousStart
+			MATCH (e:Emotion)
+			OPTIONAL MATCH (e)-[t:TAGGED]->(n)
+			WITH e, t, datetime(n.createdAt) AS taggedAt, recentStart, previousStart
+			RETURN e.type AS type,
+			       count(t) AS usageCount,
+			       avg(t.score) AS averageScore,
+			       max(taggedAt) AS lastUsedAt,
+			       count(CASE WHEN taggedAt >= recentStart THEN 1 END) AS recentCount,
+			       count(CASE WHEN taggedAt >= previousStart AND taggedAt < recentStart THEN 1 END) AS previousCount
+		`, map[string]any{"windowSeconds": int64(window.Seconds())})
+		if err != nil {
+			return nil, err
+		}
+
+		var stats []EmotionTagStats
+		for records.Next(context.Background()) {
+			record := records.Record()
+			etype, _ := record.Get("type")
+			if etype == nil {
+				continue
+			}
+			usageCount, _ := record.Get("usageCount")
+			recentCount, _ := record.Get("recentCount")
+			previousCount, _ := record.Get("previousCount")
+
+			s := EmotionTagStats{
+				Type:          etype.(string),
+				UsageCount:    int(usageCount.(int64)),
+				RecentCount:   int(recentCount.(int64)),
+				PreviousCount: int(previousCount.(int64)),
+			}
+			if avg, _ := record.Get("averageScore"); avg != nil {
+				s.AverageScore = avg.(float64)
+			}
+			if last, _ := record.Get("lastUsedAt"); last != nil {
+				s.LastUsedAt = last.(time.Time)
+			}
+			stats = append(stats, s)
+		}
+		return stats, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]EmotionTagStats), nil
+}
+
+// CorrectPostEmotions replaces a post's tags with the author's correction.
+// Tags the author kept unchanged stay marked as model tags, others are
+// marked as user tags. The model's tags are snapshotted on the first
+// correction so the original output is never lost.
+func (c *Neo4jClient) CorrectPostEmotions(postId, userId string, emotions []EmotionTag) ([]EmotionTag, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	correctedAt := time.Now().UTC().Format(time.RFC3339)
+
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		rec, err := tx.Run(context.Background(), `
+			MATCH (p:Post {id: $postId})
+			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
+			RETURN p.modelEmotions AS snapshot,
+			       collect({type: e.type, score: t.score, source: t.source}) AS emotions
+		`, map[string]any{"postId": postId})
+		if err != nil {
+			return nil, err
+		}
+		record, err := rec.Single(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		current, _ := record.Get("emotions")
+		snapshot, _ := record.Get("snapshot")
+
+		// 初回の修正時にモデルの出力を保存しておく
+		var model []EmotionTag
+		if s, ok := snapshot.(string); ok {
+			if err := json.Unmarshal([]byte(s), &model); err != nil {
+				return nil, err
+			}
+		} else {
+			for _, tag := range emotionTagsFrom(current) {
+				if tag.Source == TagSourceModel {
+					model = append(model, EmotionTag{Type: tag.Type, Score: tag.Score})
+				}
+			}
+			if model == nil {
+				model = []EmotionTag{}
+			}
+		}
+		modelJSON, err := json.Marshal(model)
+		if err != nil {
+			return nil, err
+		}
+
+		modelScores := map[string]float64{}
+		for _, tag := range model {
+			modelScores[tag.Type] = tag.Score
+		}
+		tags := make([]EmotionTag, len(emotions))
+		rows := make([]map[string]any, len(emotions))
+		for i, e := range emotions {
+			source := TagSourceUser
+			if score, ok := modelScores[e.Type]; ok && score == e.Score {
+				source = TagSourceModel
+			}
+			tags[i] = EmotionTag{Type: e.Type, Score: e.Score, Source: source}
+			rows[i] = map[string]any{"type": e.Type, "score": e.Score, "source": source}
+		}
+
+		_, err = tx.Run(context.Background(), `
+			MATCH (p:Post {id: $postId})
+			OPTIONAL MATCH (:Emotion)-[t:TAGGED]->(p)
+			DELETE t
+			WITH DISTINCT p
+			SET p.modelEmotions = $model,
+			    p.correctedBy = $userId,
+			    p.correctedAt = $correctedAt
 		`, map[string]any{
-			"userId":       userId,
-			"targetUserId": targetUserId,
+			"postId":      postId,
+			"userId":      userId,
+			"model":       string(modelJSON),
+			"correctedAt": correctedAt,
 		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Run(context.Background(), `
+			MATCH (p:Post {id: $postId})
+			UNWIND $tags AS tag
+			MERGE (em:Emotion {type: tag.type})
+			CREATE (em)-[:TAGGED {score: tag.score, source: tag.source}]->(p)
+		`, map[string]any{"postId": postId, "tags": rows})
+		if err != nil {
+			return nil, err
+		}
+
+		return tags, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]EmotionTag), nil
+}
+
+// GetEmotionCorrections returns corrected posts in correction order,
+// starting at since (an RFC 3339 timestamp, empty for all)
+func (c *Neo4jClient) GetEmotionCorrections(since string, limit int) ([]EmotionCorrection, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			MATCH (p:Post)
+			WHERE p.correctedAt IS NOT NULL AND p.correctedAt >= $since
+			WITH p ORDER BY p.correctedAt, p.id LIMIT $limit
+			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
+			RETURN p.id AS postId,
+			       p.content AS content,
+			       p.rawEmotions AS rawEmotions,
+			       p.modelEmotions AS modelEmotions,
+			       p.correctedBy AS correctedBy,
+			       p.correctedAt AS correctedAt,
+			       collect({type: e.type, score: t.score, source: t.source}) AS emotions
+			ORDER BY correctedAt, postId
+		`, map[string]any{"since": since, "limit": limit})
+		if err != nil {
+			return nil, err
+		}
+
+		corrections := []EmotionCorrection{}
+		for records.Next(context.Background()) {
+			record := records.Record()
+			postId, _ := record.Get("postId")
+			content, _ := record.Get("content")
+			raw, _ := record.Get("rawEmotions")
+			model, _ := record.Get("modelEmotions")
+			correctedBy, _ := record.Get("correctedBy")
+			correctedAt, _ := record.Get("correctedAt")
+			emotions, _ := record.Get("emotions")
+
+			correction := EmotionCorrection{
+				PostID:       postId.(string),
+				Content:      content.(string),
+				UserEmotions: emotionTagsFrom(emotions),
+				CorrectedBy:  correctedBy.(string),
+				CorrectedAt:  correctedAt.(string),
+			}
+			// Posts created before raw output was recorded have no rawEmotions
+			if s, ok := raw.(string); ok {
+				json.Unmarshal([]byte(s), &correction.RawEmotions)
+			}
+			if s, ok := model.(string); ok {
+				json.Unmarshal([]byte(s), &correction.ModelEmotions)
+			}
+			corrections = append(corrections, correction)
+		}
+		return corrections, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]EmotionCorrection), nil
+}
+
+// searchFilter restricts full-text matches (node, score) by author and date,
+// and drops posts the viewer can't see along with the replies to them
+var searchFilter = `
+	CALL db.index.fulltext.queryNodes('contentSearch', $text) YIELD node, score
+	MATCH (author:User)-[:POSTED|REPLIED]->(node)
+	MATCH (owner:User)-[:POSTED]->(post:Post)<-[:REPLY_TO*0..]-(node)
+	WHERE ($authorId = '' OR author.id = $authorId)
+	  AND ($from = '' OR node.createdAt >= $from)
+	  AND ($to = '' OR node.createdAt <= $to)
+	  AND ` + visiblePost("owner", "post") + `
+`
+
+// Search runs a full-text query over posts and replies
+func (c *Neo4jClient) Search(query SearchQuery) (SearchResult, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	params := map[string]any{
+		"text":     query.Text,
+		"emotion":  query.Emotion,
+		"authorId": query.AuthorID,
+		"from":     query.From,
+		"to":       query.To,
+		"limit":    query.Limit,
+		"offset":   query.Offset,
+		"viewerId": query.ViewerID,
+	}
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		res := SearchResult{Hits: []SearchHit{}, Facets: map[string]int{}}
+
+		records, err := tx.Run(context.Background(), searchFilter+`
+			AND ($emotion = '' OR EXISTS { MATCH (:Emotion {type: $emotion})-[:TAGGED]->(node) })
+			WITH node, score, author, post
+			ORDER BY score DESC, node.createdAt DESC
+			WITH collect({node: node, score: score, userId: author.id, postId: post.id}) AS hits
+			WITH size(hits) AS total, hits[$offset..($offset + $limit)] AS page
+			UNWIND (CASE WHEN size(page) = 0 THEN [null] ELSE page END) AS hit
+			WITH total, hit, hit.node AS n
+			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(n)
+			WITH total, hit, n, collect({type: e.type, score: t.score, source: t.source}) AS emotions
+			RETURN total,
+			       n.id AS id,
+			       CASE WHEN n:Reply THEN 'reply' ELSE 'post' END AS kind,
+			       hit.postId AS postId,
+			       hit.userId AS userId,
+			       n.content AS content,
+			       n.createdAt AS createdAt,
+			       hit.score AS score,
+			       emotions
+			ORDER BY score DESC, createdAt DESC
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(context.Background()) {
+			record := records.Record()
+			total, _ := record.Get("total")
+			res.Total = int(total.(int64))
+
+			id, _ := record.Get("id")
+			if id == nil {
+				continue // no hits on this page
+			}
+			kind, _ := record.Get("kind")
+			postId, _ := record.Get("postId")
+			userId, _ := record.Get("userId")
+			content, _ := record.Get("content")
+			createdAt, _ := record.Get("createdAt")
+			score, _ := record.Get("score")
+			emotions, _ := record.Get("emotions")
+
+			res.Hits = append(res.Hits, SearchHit{
+				Kind:        kind.(string),
+				ID:          id.(string),
+				PostID:      postId.(string),
+				UserID:      userId.(string),
+				Content:     content.(string),
+				CreatedAt:   createdAt.(string),
+				Score:       score.(float64),
+				EmotionTags: emotionTagsFrom(emotions),
+			})
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		facets, err := tx.Run(context.Background(), searchFilter+`
+			MATCH (e:Emotion)-[:TAGGED]->(node)
+			RETURN e.type AS emotion, count(DISTINCT node) AS count
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+		for facets.Next(context.Background()) {
+			record := facets.Record()
+			emotion, _ := record.Get("emotion")
+			count, _ := record.Get("count")
+			res.Facets[emotion.(string)] = int(count.(int64))
+		}
+		return res, facets.Err()
+	})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return result.(SearchResult), nil
+}
+
+// SyncEmotionTaxonomy creates the canonical Emotion nodes and their
+// (:Emotion)-[:PARENT]->(:Emotion) hierarchy. It is idempotent.
+func (c *Neo4jClient) SyncEmotionTaxonomy(defs []EmotionDefinition) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	rows := make([]map[string]any, len(defs))
+	for i, d := range defs {
+		rows[i] = map[string]any{"type": d.Type, "parent": d.Parent, "intensity": d.Intensity}
+	}
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(context.Background(), `
+			UNWIND $defs AS def
+			MERGE (e:Emotion {type: def.type})
+			SET e.intensity = def.intensity, e.canonical = true
+		`, map[string]any{"defs": rows})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Run(context.Background(), `
+			UNWIND $defs AS def
+			WITH def WHERE def.parent <> ""
+			MATCH (e:Emotion {type: def.type})
+			MATCH (parent:Emotion {type: def.parent})
+			MERGE (e)-[:PARENT]->(parent)
+		`, map[string]any{"defs": rows})
 		return nil, err
 	})
 
 	return err
 }
 
+// MergeEmotions moves every TAGGED relation and INFLUENCED type from the
+// emotions in from onto into, then deletes the merged nodes. When a post or
+// reply was tagged with both, the higher score is kept.
+func (c *Neo4jClient) MergeEmotions(from []string, into string) (int, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	params := map[string]any{"from": from, "into": into}
+
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(context.Background(), `
+			MERGE (:Emotion {type: $into})
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+
+		rec, err := tx.Run(context.Background(), `
+			MATCH (target:Emotion {type: $into})
+			MATCH (src:Emotion)-[t:TAGGED]->(n)
+			WHERE src.type IN $from AND src.type <> $into
+			MERGE (target)-[nt:TAGGED]->(n)
+			ON CREATE SET nt = properties(t)
+			ON MATCH SET nt.score = CASE WHEN t.score > nt.score THEN t.score ELSE nt.score END
+			DELETE t
+			RETURN count(*) AS retagged
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+		record, err := rec.Single(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		retagged, _ := record.Get("retagged")
+
+		// AddInfluence keeps one edge per user, post and type, so merge into
+		// an existing edge instead of renaming and duplicating it
+		_, err = tx.Run(context.Background(), `
+			MATCH (u)-[i:INFLUENCED]->(p)
+			WHERE i.type IN $from AND i.type <> $into
+			MERGE (u)-[:INFLUENCED {type: $into}]->(p)
+			DELETE i
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Run(context.Background(), `
+			MATCH (src:Emotion)
+			WHERE src.type IN $from AND src.type <> $into
+			DETACH DELETE src
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+
+		return int(retagged.(int64)), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int), nil
+}
+
+func (c *Neo4jClient) FollowUser(userId, targetUserId string) (bool, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireUser(tx, targetUserId); err != nil {
+			return nil, err
+		}
+		if err := requireNotBlocked(tx, userId, targetUserId); err != nil {
+			return nil, err
+		}
+
+		// Following a private account needs the target's approval, unless
+		// they already approved it
+		params := map[string]any{
+			"userId":       userId,
+			"targetUserId": targetUserId,
+			"createdAt":    time.Now().UTC().Format(time.RFC3339),
+		}
+		records, err := tx.Run(context.Background(), `
+			MATCH (u1:User {id: $userId})
+			MATCH (u2:User {id: $targetUserId})
+			RETURN coalesce(u2.private, false) AND NOT EXISTS { (u1)-[:FOLLOWS]->(u2) } AS requested
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		requested := record.Values[0].(bool)
+
+		query := `
+			MATCH (u1:User {id: $userId})
+			MATCH (u2:User {id: $targetUserId})
+			MERGE (u1)-[:FOLLOWS]->(u2)
+		`
+		if requested {
+			query = `
+				MATCH (u1:User {id: $userId})
+				MATCH (u2:User {id: $targetUserId})
+				MERGE (u1)-[r:FOLLOW_REQUEST]->(u2)
+				ON CREATE SET r.createdAt = $createdAt
+			`
+		}
+		_, err = tx.Run(context.Background(), query, params)
+		return requested, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.(bool), nil
+}
+
 func (c *Neo4jClient) GetFollowers(userId string) ([]UserDetails, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
@@ -562,11 +1504,18 @@ func (c *Neo4jClient) GetFollowing(userId string) ([]UserDetails, error) {
 	return result.([]UserDetails), nil
 }
 
-func (c *Neo4jClient) GetPostContent(postId string) (string, error) {
+func (c *Neo4jClient) GetPostContent(postId string, viewer Viewer) (string, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireNotBlockedByAuthor(tx, viewer.ID, postId); err != nil {
+			return nil, err
+		}
+		if err := requireVisiblePost(tx, viewer.ID, postId); err != nil {
+			return nil, err
+		}
+
 		rec, err := tx.Run(context.Background(), `
 			MATCH (p:Post {id: $postId})
 			RETURN p.content AS content
@@ -575,7 +1524,7 @@ func (c *Neo4jClient) GetPostContent(postId string) (string, error) {
 			return nil, err
 		}
 		if !rec.Next(context.Background()) {
-			return nil, nil // Not found
+			return nil, &NotFoundError{Kind: "post", ID: postId}
 		}
 
 		record := rec.Record()
@@ -588,23 +1537,55 @@ func (c *Neo4jClient) GetPostContent(postId string) (string, error) {
 	return result.(string), nil
 }
 
-func (c *Neo4jClient) GetInfluencedPostsLast24Hours(userId string) ([]InfluencedPost, error) {
+func (c *Neo4jClient) GetShareablePostContent(postId, userId string) (string, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
-		records, err := tx.Run(context.Background(), `
-			MATCH (u:User {id: $userId})-[i:INFLUENCED]->(p:Post)
-			WHERE datetime() - duration('P1D') < datetime()
-			RETURN p.id AS postId, p.content AS content
-		`, map[string]any{"userId": userId})
-
-		if err != nil {
+		if err := requireNotBlockedByAuthor(tx, userId, postId); err != nil {
+			return nil, err
+		}
+		if err := requireShareablePost(tx, userId, postId); err != nil {
 			return nil, err
 		}
 
-		var posts []InfluencedPost
-		for records.Next(context.Background()) {
+		rec, err := tx.Run(context.Background(), `
+			MATCH (p:Post {id: $postId})
+			RETURN p.content AS content
+		`, map[string]any{"postId": postId})
+		if err != nil {
+			return nil, err
+		}
+		record, err := rec.Single(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		content, _ := record.Get("content")
+		return content.(string), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+func (c *Neo4jClient) GetInfluencedPostsLast24Hours(userId string) ([]InfluencedPost, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})-[i:INFLUENCED]->(p:Post)
+			WHERE datetime() - duration('P1D') < datetime()
+			RETURN p.id AS postId, p.content AS content
+		`, map[string]any{"userId": userId})
+
+		if err != nil {
+			return nil, err
+		}
+
+		var posts []InfluencedPost
+		for records.Next(context.Background()) {
 			record := records.Record()
 			postId, _ := record.Get("postId")
 			content, _ := record.Get("content")
@@ -644,13 +1625,17 @@ func (c *Neo4jClient) AddSameTopicRelation(fromPostID, toPostID string) error {
 	return err
 }
 
-func (c *Neo4jClient) GetPostInfluence(postId string) (PostInfluence, error) {
+// GetPostInfluence walks the INFLUENCED chain out from a post. Posts by private
+// accounts the viewer doesn't follow are left out, and so are the users only
+// reachable through them.
+func (c *Neo4jClient) GetPostInfluence(postId string, viewer Viewer) (PostInfluence, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		records, err := tx.Run(context.Background(), `
-			MATCH (p:Post {id: $postId})
+			MATCH (author:User)-[:POSTED]->(p:Post {id: $postId})
+			WHERE `+visiblePost("author", "p")+`
 			
 			// 1次の影響：投稿に直接INFLUENCEDされたユーザー
 			OPTIONAL MATCH (user1:User)-[i1:INFLUENCED]->(p)
@@ -658,17 +1643,19 @@ func (c *Neo4jClient) GetPostInfluence(postId string) (PostInfluence, error) {
 			// 2次の影響：1次ユーザーの投稿で、元の投稿とSAME_TOPICの関係にある投稿にINFLUENCEDされたユーザー
 			OPTIONAL MATCH (user1)-[:POSTED]->(p1:Post)-[:SAME_TOPIC]->(p), (user2:User)-[i2:INFLUENCED]->(p1)
 			WHERE user2 <> user1
+			  AND `+visiblePost("user1", "p1")+`
 			
 			// 3次の影響：2次ユーザーの投稿で、元の投稿とSAME_TOPICの関係にある投稿にINFLUENCEDされたユーザー
 			OPTIONAL MATCH (user2)-[:POSTED]->(p2:Post)-[:SAME_TOPIC]->(p), (user3:User)-[i3:INFLUENCED]->(p2)
 			WHERE user3 <> user2 AND user3 <> user1
+			  AND `+visiblePost("user2", "p2")+`
 			
 			RETURN {
 				firstDegree: collect(DISTINCT {userId: user1.id, type: i1.type}),
 				secondDegree: collect(DISTINCT {userId: user2.id, type: i2.type, throughPostId: p1.id}),
 				thirdDegree: collect(DISTINCT {userId: user3.id, type: i3.type, throughPostId: p2.id})
 			} AS result
-		`, map[string]any{"postId": postId})
+		`, map[string]any{"postId": postId, "viewerId": viewer.ID})
 
 		if err != nil {
 			return nil, err
@@ -785,7 +1772,22 @@ func (c *Neo4jClient) CreateUser(username, email, password string) (string, erro
 		if result.Next(context.Background()) {
 			count, _ := result.Record().Get("count")
 			if count.(int64) > 0 {
-				return nil, errors.New("email already exists")
+				return nil, ErrEmailTaken
+			}
+		}
+
+		result, err = tx.Run(context.Background(), `
+			MATCH (u:User {usernameLower: $usernameLower})
+			RETURN count(u) as count
+		`, map[string]any{"usernameLower": strings.ToLower(username)})
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Next(context.Background()) {
+			count, _ := result.Record().Get("count")
+			if count.(int64) > 0 {
+				return nil, ErrUsernameTaken
 			}
 		}
 
@@ -794,17 +1796,23 @@ func (c *Neo4jClient) CreateUser(username, email, password string) (string, erro
 			CREATE (u:User {
 				id: $userId,
 				username: $username,
+				usernameLower: $usernameLower,
+				displayName: $username,
+				bio: '',
 				email: $email,
+				emailVerified: false,
+				private: false,
 				password: $password,
 				createdAt: $createdAt
 			})
 			RETURN u.id
 		`, map[string]any{
-			"userId":    userId,
-			"username":  username,
-			"email":     email,
-			"password":  string(hashedPassword),
-			"createdAt": createdAt,
+			"userId":        userId,
+			"username":      username,
+			"usernameLower": strings.ToLower(username),
+			"email":         email,
+			"password":      string(hashedPassword),
+			"createdAt":     createdAt,
 		})
 		return nil, err
 	})
@@ -824,14 +1832,14 @@ func (c *Neo4jClient) GetUserByEmail(email string) (AuthUser, error) {
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		result, err := tx.Run(context.Background(), `
 			MATCH (u:User {email: $email})
-			RETURN u.id, u.username, u.email, u.password
+			RETURN u.id, u.username, u.email, u.password, coalesce(u.emailVerified, true) AS emailVerified
 		`, map[string]any{"email": email})
 		if err != nil {
 			return nil, err
 		}
 
 		if !result.Next(context.Background()) {
-			return nil, errors.New("user not found")
+			return nil, &NotFoundError{Kind: "user"}
 		}
 
 		record := result.Record()
@@ -839,12 +1847,14 @@ func (c *Neo4jClient) GetUserByEmail(email string) (AuthUser, error) {
 		username, _ := record.Get("u.username")
 		email, _ := record.Get("u.email")
 		password, _ := record.Get("u.password")
+		emailVerified, _ := record.Get("emailVerified")
 
 		return AuthUser{
-			ID:       id.(string),
-			Username: username.(string),
-			Email:    email.(string),
-			Password: password.(string),
+			ID:            id.(string),
+			Username:      username.(string),
+			Email:         email.(string),
+			Password:      password.(string),
+			EmailVerified: emailVerified.(bool),
 		}, nil
 	})
 
@@ -863,14 +1873,14 @@ func (c *Neo4jClient) GetUserById(userId string) (AuthUser, error) {
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		result, err := tx.Run(context.Background(), `
 			MATCH (u:User {id: $userId})
-			RETURN u.id, u.username, u.email, u.password
+			RETURN u.id, u.username, u.email, u.password, coalesce(u.emailVerified, true) AS emailVerified
 		`, map[string]any{"userId": userId})
 		if err != nil {
 			return nil, err
 		}
 
 		if !result.Next(context.Background()) {
-			return nil, errors.New("user not found")
+			return nil, &NotFoundError{Kind: "user", ID: userId}
 		}
 
 		record := result.Record()
@@ -878,13 +1888,60 @@ func (c *Neo4jClient) GetUserById(userId string) (AuthUser, error) {
 		username, _ := record.Get("u.username")
 		email, _ := record.Get("u.email")
 		password, _ := record.Get("u.password")
+		emailVerified, _ := record.Get("emailVerified")
 
-		return AuthUser{
-			ID:       id.(string),
-			Username: username.(string),
-			Email:    email.(string),
-			Password: password.(string),
-		}, nil
+		// Deleted (anonymized) users have no email or password
+		user := AuthUser{
+			ID:            id.(string),
+			Username:      username.(string),
+			EmailVerified: emailVerified.(bool),
+		}
+		user.Email, _ = email.(string)
+		user.Password, _ = password.(string)
+		return user, nil
+	})
+
+	if err != nil {
+		return AuthUser{}, err
+	}
+
+	return result.(AuthUser), nil
+}
+
+// GetUserByUsername retrieves a user by username, ignoring case
+func (c *Neo4jClient) GetUserByUsername(username string) (AuthUser, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User {usernameLower: $usernameLower})
+			RETURN u.id, u.username, u.email, u.password, coalesce(u.emailVerified, true) AS emailVerified
+		`, map[string]any{"usernameLower": strings.ToLower(username)})
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next(context.Background()) {
+			return nil, &NotFoundError{Kind: "user"}
+		}
+
+		record := result.Record()
+		id, _ := record.Get("u.id")
+		username, _ := record.Get("u.username")
+		email, _ := record.Get("u.email")
+		password, _ := record.Get("u.password")
+		emailVerified, _ := record.Get("emailVerified")
+
+		// Deleted (anonymized) users have no email or password
+		user := AuthUser{
+			ID:            id.(string),
+			Username:      username.(string),
+			EmailVerified: emailVerified.(bool),
+		}
+		user.Email, _ = email.(string)
+		user.Password, _ = password.(string)
+		return user, nil
 	})
 
 	if err != nil {
@@ -894,12 +1951,22 @@ func (c *Neo4jClient) GetUserById(userId string) (AuthUser, error) {
 	return result.(AuthUser), nil
 }
 
-// ValidateUserCredentials validates user credentials and returns the user ID if valid
-func (c *Neo4jClient) ValidateUserCredentials(email, password string) (string, error) {
-	user, err := c.GetUserByEmail(email)
+// ValidateUserCredentials validates user credentials and returns the user ID
+// if valid. login is an email address or a username.
+func (c *Neo4jClient) ValidateUserCredentials(login, password string) (string, error) {
+	var user AuthUser
+	var err error
+	if strings.Contains(login, "@") {
+		user, err = c.GetUserByEmail(login)
+	} else {
+		user, err = c.GetUserByUsername(login)
+	}
 	if err != nil {
 		return "", err
 	}
+	if user.Password == "" {
+		return "", errors.New("invalid credentials")
+	}
 
 	// Compare the provided password with the stored hash
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
@@ -910,195 +1977,766 @@ func (c *Neo4jClient) ValidateUserCredentials(email, password string) (string, e
 	return user.ID, nil
 }
 
-// GetUserWithDetails retrieves a user with follower and following counts
-func (c *Neo4jClient) GetUserWithDetails(userId string) (UserDetails, error) {
+func (c *Neo4jClient) CreateAccountToken(userId, purpose, tokenHash string, ttl time.Duration) error {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
-	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+	now := time.Now().UTC()
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		// Sweep expired tokens while we're here
+		_, err := tx.Run(context.Background(), `
+			MATCH (t:AccountToken) WHERE t.expiresAt < $now
+			DETACH DELETE t
+		`, map[string]any{"now": now.Format(time.RFC3339)})
+		if err != nil {
+			return nil, err
+		}
+
 		result, err := tx.Run(context.Background(), `
 			MATCH (u:User {id: $userId})
-			RETURN u.id, u.username, u.email
-		`, map[string]any{"userId": userId})
+			OPTIONAL MATCH (u)-[:HAS_TOKEN]->(old:AccountToken {purpose: $purpose})
+			DETACH DELETE old
+			WITH DISTINCT u
+			CREATE (u)-[:HAS_TOKEN]->(:AccountToken {
+				hash: $hash,
+				purpose: $purpose,
+				createdAt: $now,
+				expiresAt: $expiresAt
+			})
+			RETURN u.id
+		`, map[string]any{
+			"userId":    userId,
+			"purpose":   purpose,
+			"hash":      tokenHash,
+			"now":       now.Format(time.RFC3339),
+			"expiresAt": now.Add(ttl).Format(time.RFC3339),
+		})
 		if err != nil {
 			return nil, err
 		}
+		if !result.Next(context.Background()) {
+			return nil, &NotFoundError{Kind: "user", ID: userId}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (c *Neo4jClient) ConsumeAccountToken(purpose, tokenHash string) (string, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
 
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User)-[:HAS_TOKEN]->(t:AccountToken {hash: $hash, purpose: $purpose})
+			WITH u, t, t.expiresAt >= $now AS valid
+			DETACH DELETE t
+			RETURN u.id AS userId, valid
+		`, map[string]any{
+			"hash":    tokenHash,
+			"purpose": purpose,
+			"now":     time.Now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, err
+		}
 		if !result.Next(context.Background()) {
-			return nil, errors.New("user not found")
+			return "", nil
 		}
+		userId, _ := result.Record().Get("userId")
+		valid, _ := result.Record().Get("valid")
+		if !valid.(bool) {
+			return "", nil
+		}
+		return userId.(string), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
 
-		record := result.Record()
-		id, _ := record.Get("u.id")
-		username, _ := record.Get("u.username")
-		email, _ := record.Get("u.email")
+func (c *Neo4jClient) MarkEmailVerified(userId string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			SET u.emailVerified = true, u.emailVerifiedAt = $now
+		`, map[string]any{"userId": userId, "now": time.Now().UTC().Format(time.RFC3339)})
+		return nil, err
+	})
+	return err
+}
 
-		// Generate avatar URL from username
-		avatarUrl := "https://ui-avatars.com/api/?name=" + username.(string)
+func (c *Neo4jClient) UpdatePassword(userId, password string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
 
-		// Default display name to username if not set
-		displayName := username.(string)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
 
-		// Get follower count
-		followersCount, err := c.CountFollowers(userId)
+	_, err = session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			SET u.password = $password, u.passwordChangedAt = $now
+			WITH u
+			OPTIONAL MATCH (u)-[:HAS_TOKEN]->(t:AccountToken {purpose: $purpose})
+			DETACH DELETE t
+			RETURN DISTINCT u.id
+		`, map[string]any{
+			"userId":   userId,
+			"password": string(hashedPassword),
+			"now":      time.Now().UTC().Format(time.RFC3339),
+			"purpose":  TokenPasswordReset,
+		})
 		if err != nil {
-			followersCount = 0
+			return nil, err
 		}
+		if !result.Next(context.Background()) {
+			return nil, &NotFoundError{Kind: "user", ID: userId}
+		}
+		return nil, nil
+	})
+	return err
+}
 
-		// Get following count
-		followingCount, err := c.CountFollowing(userId)
+func (c *Neo4jClient) DeleteUser(userId string, purge bool) (string, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	params := map[string]any{
+		"userId":   userId,
+		"username": "deleted-" + userId,
+		"now":      time.Now().UTC().Format(time.RFC3339),
+	}
+
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			RETURN u.avatarKey AS avatarKey
+		`, params)
 		if err != nil {
-			followingCount = 0
+			return nil, err
+		}
+		if !result.Next(context.Background()) {
+			return nil, &NotFoundError{Kind: "user", ID: userId}
+		}
+		avatarKey, _ := result.Record().Get("avatarKey")
+
+		statements := []string{`
+			MATCH (:User {id: $userId})-[r:REACTED|REPOSTED|FOLLOWS|FOLLOW_REQUEST|INFLUENCED|BLOCKS|MUTES|FILTERS]-()
+			DELETE r
+		`, `
+			MATCH (:User {id: $userId})-[:HAS_TOKEN]->(t:AccountToken)
+			DETACH DELETE t
+		`}
+		if purge {
+			statements = append(statements, `
+				MATCH (:User {id: $userId})-[:POSTED]->(:Post)<-[:REPLY_TO*]-(r:Reply)
+				DETACH DELETE r
+			`, `
+				MATCH (:User {id: $userId})-[:REPLIED]->(:Reply)<-[:REPLY_TO*0..]-(r:Reply)
+				DETACH DELETE r
+			`, `
+				MATCH (:User {id: $userId})-[:POSTED]->(p:Post)
+				DETACH DELETE p
+			`, `
+				MATCH (u:User {id: $userId})
+				DETACH DELETE u
+			`)
+		} else {
+			// 投稿と返信は残し、本人を特定できる情報だけ消す
+			statements = append(statements, `
+				MATCH (u:User {id: $userId})
+				SET u.username = $username, u.usernameLower = $username, u.deletedAt = $now
+				REMOVE u.email, u.password, u.displayName, u.bio, u.avatarKey, u.avatarUrl,
+				       u.emailVerified, u.emailVerifiedAt
+			`)
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Run(context.Background(), stmt, params); err != nil {
+				return nil, err
+			}
 		}
 
-		return UserDetails{
-			ID:             id.(string),
-			Username:       username.(string),
-			DisplayName:    displayName,
-			Email:          email.(string),
-			AvatarUrl:      avatarUrl,
-			Bio:            "", // Default empty bio
-			FollowersCount: followersCount,
-			FollowingCount: followingCount,
-		}, nil
+		key, _ := avatarKey.(string)
+		return key, nil
 	})
-
 	if err != nil {
-		return UserDetails{}, err
+		return "", err
 	}
-
-	return result.(UserDetails), nil
+	return result.(string), nil
 }
 
-// GetUserPosts retrieves all posts by a specific user
-func (c *Neo4jClient) GetUserPosts(userId string) ([]FeedPost, error) {
+// FindPhantomUsers lists User nodes without a username. Every registered
+// user has one, including anonymized deleted users.
+func (c *Neo4jClient) FindPhantomUsers() ([]PhantomUser, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		records, err := tx.Run(context.Background(), `
-			MATCH (u:User {id: $userId})-[:POSTED]->(p:Post)
-			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
-			OPTIONAL MATCH (reactor:User)-[r:REACTED]->(p)
-			OPTIONAL MATCH (replier:User)-[:REPLIED]->(reply:Reply)-[:REPLY_TO]->(p)
-			RETURN 
-				p.id AS postId,
-				p.content AS content,
-				u.id AS userId,
-				p.createdAt AS createdAt,
-				collect(DISTINCT {type: e.type, score: t.score}) AS emotions,
-				collect(DISTINCT {type: r.type}) AS reactions,
-				count(DISTINCT reply) AS replyCount
-			ORDER BY p.createdAt DESC
-		`, map[string]any{"userId": userId})
+			MATCH (u:User)
+			WHERE u.username IS NULL
+			RETURN u.id AS id,
+			       COUNT { (u)-[:POSTED]->(:Post) } AS posts,
+			       COUNT { (u)-[:REPLIED]->(:Reply) } AS replies,
+			       COUNT { (u)-[:REACTED]->() } AS reactions,
+			       COUNT { (u)-[:FOLLOWS]-() } AS follows
+			ORDER BY id
+		`, nil)
 		if err != nil {
 			return nil, err
 		}
 
-		var posts []FeedPost
+		users := []PhantomUser{}
 		for records.Next(context.Background()) {
-			rec := records.Record()
-
-			// emotionTags
-			emotionsRaw := rec.Values[4].([]any)
-			var emotions []EmotionTag
-			for _, e := range emotionsRaw {
-				if m, ok := e.(map[string]any); ok {
-					emotions = append(emotions, EmotionTag{
-						Type:  m["type"].(string),
-						Score: m["score"].(float64),
-					})
-				}
-			}
-
-			// reactions
-			reactionsRaw := rec.Values[5].([]any)
-			reactionCounts := map[string]int{}
-			for _, r := range reactionsRaw {
-				if m, ok := r.(map[string]any); ok {
-					if reactionType, ok := m["type"].(string); ok && reactionType != "" {
-						reactionCounts[reactionType]++
-					}
-				}
+			record := records.Record()
+			id, _ := record.Get("id")
+			posts, _ := record.Get("posts")
+			replies, _ := record.Get("replies")
+			reactions, _ := record.Get("reactions")
+			follows, _ := record.Get("follows")
+
+			user := PhantomUser{
+				Posts:     int(posts.(int64)),
+				Replies:   int(replies.(int64)),
+				Reactions: int(reactions.(int64)),
+				Follows:   int(follows.(int64)),
 			}
-
-			// reply count
-			replyCount := int(rec.Values[6].(int64))
-
-			posts = append(posts, FeedPost{
-				PostID:      rec.Values[0].(string),
-				Content:     rec.Values[1].(string),
-				UserID:      rec.Values[2].(string),
-				CreatedAt:   rec.Values[3].(string),
-				EmotionTags: emotions,
-				Reactions:   reactionCounts,
-				ReplyCount:  replyCount,
-			})
+			// MERGE with a null ID fails, but be tolerant of hand-made nodes
+			user.ID, _ = id.(string)
+			users = append(users, user)
 		}
-		return posts, nil
+		return users, records.Err()
 	})
 	if err != nil {
 		return nil, err
 	}
-	return result.([]FeedPost), nil
+	return result.([]PhantomUser), nil
 }
 
-// CountFollowers counts the number of followers for a user
-func (c *Neo4jClient) CountFollowers(userId string) (int, error) {
+func (c *Neo4jClient) DeletePhantomUsers() (int, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
-	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		statements := []string{`
+			MATCH (u:User)-[:POSTED|REPLIED]->()<-[:REPLY_TO*]-(r:Reply)
+			WHERE u.username IS NULL
+			DETACH DELETE r
+		`, `
+			MATCH (u:User)-[:POSTED|REPLIED]->(n)
+			WHERE u.username IS NULL
+			DETACH DELETE n
+		`}
+		for _, stmt := range statements {
+			if _, err := tx.Run(context.Background(), stmt, nil); err != nil {
+				return nil, err
+			}
+		}
+
 		result, err := tx.Run(context.Background(), `
-			MATCH (follower:User)-[:FOLLOWS]->(u:User {id: $userId})
-			RETURN count(follower) AS followerCount
-		`, map[string]any{"userId": userId})
+			MATCH (u:User)
+			WHERE u.username IS NULL
+			DETACH DELETE u
+			RETURN count(u) AS removed
+		`, nil)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-
-		if !result.Next(context.Background()) {
-			return 0, nil
+		record, err := result.Single(context.Background())
+		if err != nil {
+			return nil, err
 		}
-
-		record := result.Record()
-		count, _ := record.Get("followerCount")
-		return int(count.(int64)), nil
+		removed, _ := record.Get("removed")
+		return int(removed.(int64)), nil
 	})
-
 	if err != nil {
 		return 0, err
 	}
-
 	return result.(int), nil
 }
 
-// CountFollowing counts the number of users a user is following
-func (c *Neo4jClient) CountFollowing(userId string) (int, error) {
+// GetUserWithDetails retrieves a user with follower and following counts
+func (c *Neo4jClient) GetUserWithDetails(userId string) (UserDetails, error) {
 	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
 	defer session.Close(context.Background())
 
 	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		result, err := tx.Run(context.Background(), `
-			MATCH (u:User {id: $userId})-[:FOLLOWS]->(followed:User)
-			RETURN count(followed) AS followingCount
+			MATCH (u:User {id: $userId})
+			RETURN u.id, u.username, u.email, u.displayName, u.bio, u.avatarUrl, coalesce(u.private, false) AS private
 		`, map[string]any{"userId": userId})
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
 		if !result.Next(context.Background()) {
-			return 0, nil
+			return nil, &NotFoundError{Kind: "user", ID: userId}
 		}
 
 		record := result.Record()
-		count, _ := record.Get("followingCount")
-		return int(count.(int64)), nil
-	})
-
-	if err != nil {
-		return 0, err
-	}
+		id, _ := record.Get("u.id")
+		username, _ := record.Get("u.username")
+		email, _ := record.Get("u.email")
+		storedDisplayName, _ := record.Get("u.displayName")
+		storedBio, _ := record.Get("u.bio")
+		storedAvatarUrl, _ := record.Get("u.avatarUrl")
+		private, _ := record.Get("private")
+
+		// Users created before profiles were editable have none of these set
+		displayName, _ := storedDisplayName.(string)
+		if displayName == "" {
+			displayName = username.(string)
+		}
+		bio, _ := storedBio.(string)
+		avatarUrl, _ := storedAvatarUrl.(string)
+		if avatarUrl == "" {
+			avatarUrl = defaultAvatarUrl(username.(string))
+		}
+
+		// Get follower count
+		followersCount, err := c.CountFollowers(userId)
+		if err != nil {
+			followersCount = 0
+		}
+
+		// Get following count
+		followingCount, err := c.CountFollowing(userId)
+		if err != nil {
+			followingCount = 0
+		}
+
+		// Deleted (anonymized) users have no email
+		emailAddress, _ := email.(string)
+
+		return UserDetails{
+			ID:             id.(string),
+			Username:       username.(string),
+			DisplayName:    displayName,
+			Email:          emailAddress,
+			AvatarUrl:      avatarUrl,
+			Bio:            bio,
+			FollowersCount: followersCount,
+			FollowingCount: followingCount,
+			Private:        private.(bool),
+		}, nil
+	})
+
+	if err != nil {
+		return UserDetails{}, err
+	}
+
+	return result.(UserDetails), nil
+}
+
+func (c *Neo4jClient) UpdateUserProfile(userId string, update ProfileUpdate) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			SET u.displayName = coalesce($displayName, u.displayName),
+			    u.bio = coalesce($bio, u.bio),
+			    u.private = coalesce($private, u.private, false),
+			    u.updatedAt = $updatedAt
+			RETURN u.id
+		`, map[string]any{
+			"userId":      userId,
+			"displayName": update.DisplayName,
+			"bio":         update.Bio,
+			"private":     update.Private,
+			"updatedAt":   time.Now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Next(context.Background()) {
+			return nil, &NotFoundError{Kind: "user", ID: userId}
+		}
+		if err := result.Err(); err != nil {
+			return nil, err
+		}
+
+		// Nobody needs approval to follow a public account
+		_, err = tx.Run(context.Background(), `
+			MATCH (requester:User)-[r:FOLLOW_REQUEST]->(u:User {id: $userId})
+			WHERE NOT u.private
+			MERGE (requester)-[:FOLLOWS]->(u)
+			DELETE r
+		`, map[string]any{"userId": userId})
+		return nil, err
+	})
+	return err
+}
+
+func (c *Neo4jClient) SetUserAvatar(userId, key, avatarUrl string) (string, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	// Setting a property to null removes it
+	var keyParam, urlParam any
+	if key != "" {
+		keyParam, urlParam = key, avatarUrl
+	}
+
+	result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			WITH u, u.avatarKey AS previousKey
+			SET u.avatarKey = $key, u.avatarUrl = $url
+			RETURN previousKey
+		`, map[string]any{"userId": userId, "key": keyParam, "url": urlParam})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Next(context.Background()) {
+			return nil, &NotFoundError{Kind: "user", ID: userId}
+		}
+		previousKey, _ := result.Record().Get("previousKey")
+		s, _ := previousKey.(string)
+		return s, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+// defaultAvatarUrl generates an avatar from the username for users who
+// haven't uploaded one
+func defaultAvatarUrl(username string) string {
+	return "https://ui-avatars.com/api/?name=" + url.QueryEscape(username)
+}
+
+// userSummaryFrom reads the id, username, displayName and avatarUrl columns
+// of a record
+func userSummaryFrom(record *neo4j.Record) UserSummary {
+	id, _ := record.Get("id")
+	username, _ := record.Get("username")
+	displayName, _ := record.Get("displayName")
+	avatarUrl, _ := record.Get("avatarUrl")
+	summary := UserSummary{}
+	summary.ID, _ = id.(string)
+	summary.Username, _ = username.(string)
+	summary.DisplayName, _ = displayName.(string)
+	summary.AvatarUrl = defaultAvatarUrl(summary.Username)
+	if avatarUrl, ok := avatarUrl.(string); ok && avatarUrl != "" {
+		summary.AvatarUrl = avatarUrl
+	}
+	return summary
+}
+
+func (c *Neo4jClient) SearchUsers(text string, limit int) ([]UserSummary, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			CALL db.index.fulltext.queryNodes('userSearch', $text) YIELD node, score
+			WHERE node.deletedAt IS NULL
+			RETURN node.id AS id,
+			       node.username AS username,
+			       coalesce(node.displayName, node.username) AS displayName,
+			       node.avatarUrl AS avatarUrl
+			ORDER BY score DESC, size(node.username)
+			LIMIT $limit
+		`, map[string]any{"text": text, "limit": limit})
+		if err != nil {
+			return nil, err
+		}
+
+		users := []UserSummary{}
+		for records.Next(context.Background()) {
+			users = append(users, userSummaryFrom(records.Record()))
+		}
+		return users, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]UserSummary), nil
+}
+
+const (
+	// suggestionCandidates caps how many users each signal contributes
+	suggestionCandidates = 200
+	// suggestionWindow bounds emotion profiles to recent posts and replies,
+	// so the overlap query doesn't walk every TAGGED edge of each emotion
+	suggestionWindow = 30 * 24 * time.Hour
+	// mutualFollowsSaturation is the mutual follow count that earns the full
+	// friends-of-friends share of the score
+	mutualFollowsSaturation = 5
+	mutualFollowsWeight     = 0.6
+	emotionSimilarityWeight = 0.4
+)
+
+// GetUserSuggestions ranks users the user doesn't follow yet by how many of
+// the people they follow already follow them, and by how similar their
+// emotion profiles (summed tag scores over the last suggestionWindow of
+// posts and replies) are
+func (c *Neo4jClient) GetUserSuggestions(userId string, limit int) ([]UserSuggestion, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		since := time.Now().UTC().Add(-suggestionWindow).Format(time.RFC3339)
+		params := map[string]any{"userId": userId, "candidates": suggestionCandidates, "since": since}
+
+		// 友達の友達
+		mutual := map[string]int{}
+		records, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})-[:FOLLOWS]->(f:User)-[:FOLLOWS]->(c:User)
+			WHERE c <> u AND c.username IS NOT NULL AND c.deletedAt IS NULL
+			  AND NOT (u)-[:FOLLOWS]->(c) AND NOT (u)-[:BLOCKS]-(c)
+			RETURN c.id AS id, count(DISTINCT f) AS mutual
+			ORDER BY mutual DESC
+			LIMIT $candidates
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(context.Background()) {
+			id, _ := records.Record().Get("id")
+			count, _ := records.Record().Get("mutual")
+			mutual[id.(string)] = int(count.(int64))
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		// 同じ感情で投稿しているユーザー
+		ids := []string{userId}
+		for id := range mutual {
+			ids = append(ids, id)
+		}
+		records, err = tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})-[:POSTED|REPLIED]->(own)<-[:TAGGED]-(e:Emotion)
+			WHERE own.createdAt >= $since
+			WITH u, collect(DISTINCT e) AS emotions
+			CALL {
+				MATCH (n:Post) WHERE n.createdAt >= $since RETURN n
+				UNION
+				MATCH (n:Reply) WHERE n.createdAt >= $since RETURN n
+			}
+			MATCH (c:User)-[:POSTED|REPLIED]->(n)<-[t:TAGGED]-(e:Emotion)
+			WHERE e IN emotions
+			  AND c <> u AND c.username IS NOT NULL AND c.deletedAt IS NULL
+			  AND NOT (u)-[:FOLLOWS]->(c) AND NOT (u)-[:BLOCKS]-(c)
+			RETURN c.id AS id, sum(t.score) AS overlap
+			ORDER BY overlap DESC
+			LIMIT $candidates
+		`, params)
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(context.Background()) {
+			id, _ := records.Record().Get("id")
+			if _, ok := mutual[id.(string)]; !ok {
+				ids = append(ids, id.(string))
+			}
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		profiles := map[string]map[string]float64{}
+		records, err = tx.Run(context.Background(), `
+			MATCH (x:User)-[:POSTED|REPLIED]->(n)<-[t:TAGGED]-(e:Emotion)
+			WHERE x.id IN $ids AND n.createdAt >= $since
+			RETURN x.id AS id, e.type AS emotion, sum(t.score) AS weight
+		`, map[string]any{"ids": ids, "since": since})
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(context.Background()) {
+			record := records.Record()
+			id, _ := record.Get("id")
+			emotion, _ := record.Get("emotion")
+			weight, _ := record.Get("weight")
+			if profiles[id.(string)] == nil {
+				profiles[id.(string)] = map[string]float64{}
+			}
+			profiles[id.(string)][emotion.(string)] = weight.(float64)
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		suggestions := make([]UserSuggestion, 0, len(ids)-1)
+		for _, id := range ids[1:] {
+			similarity := cosineSimilarity(profiles[userId], profiles[id])
+			suggestions = append(suggestions, UserSuggestion{
+				UserSummary:       UserSummary{ID: id},
+				MutualFollows:     mutual[id],
+				EmotionSimilarity: similarity,
+				Score: mutualFollowsWeight*float64(min(mutual[id], mutualFollowsSaturation))/mutualFollowsSaturation +
+					emotionSimilarityWeight*similarity,
+			})
+		}
+		slices.SortFunc(suggestions, func(a, b UserSuggestion) int {
+			return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.ID, b.ID))
+		})
+		suggestions = suggestions[:min(limit, len(suggestions))]
+
+		// Fill in the profiles of the users we're returning
+		top := make([]string, len(suggestions))
+		for i, s := range suggestions {
+			top[i] = s.ID
+		}
+		records, err = tx.Run(context.Background(), `
+			MATCH (x:User) WHERE x.id IN $ids
+			RETURN x.id AS id, x.username AS username, coalesce(x.displayName, x.username) AS displayName,
+			       x.avatarUrl AS avatarUrl
+		`, map[string]any{"ids": top})
+		if err != nil {
+			return nil, err
+		}
+		summaries := map[string]UserSummary{}
+		for records.Next(context.Background()) {
+			summary := userSummaryFrom(records.Record())
+			summaries[summary.ID] = summary
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+		for i := range suggestions {
+			suggestions[i].UserSummary = summaries[suggestions[i].ID]
+		}
+		return suggestions, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]UserSuggestion), nil
+}
+
+// cosineSimilarity compares two sparse vectors; it is 0 if either is empty
+func cosineSimilarity(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for k, v := range a {
+		dot += v * b[k]
+		normA += v * v
+	}
+	for _, v := range b {
+		normB += v * v
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// GetUserPosts retrieves all posts by a specific user, leaving out those
+// matching the viewer's emotion filters
+func (c *Neo4jClient) GetUserPosts(userId string, viewer Viewer) ([]FeedPost, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})-[:POSTED]->(p:Post)
+			WHERE `+visiblePost("u", "p")+`
+			  AND NOT EXISTS {
+				MATCH (:User {id: $filterUserId})-[f:FILTERS]->(:Emotion)<-[:PARENT*0..]-(:Emotion)-[t:TAGGED]->(p)
+				WHERE t.score >= f.minScore AND (f.until IS NULL OR f.until > $now)
+			  }
+			OPTIONAL MATCH (e:Emotion)-[t:TAGGED]->(p)
+			OPTIONAL MATCH (reactor:User)-[r:REACTED]->(p)
+			OPTIONAL MATCH (replier:User)-[:REPLIED]->(reply:Reply)-[:REPLY_TO*]->(p)
+			OPTIONAL MATCH (p)-[:QUOTES]->(quoted:Post)
+			RETURN 
+				p.id AS postId,
+				p.content AS content,
+				u.id AS userId,
+				p.createdAt AS createdAt,
+				collect(DISTINCT {type: e.type, score: t.score, source: t.source}) AS emotions,
+				collect(DISTINCT {type: r.type}) AS reactions,
+				count(DISTINCT reply) AS replyCount,
+				coalesce(p.visibility, 'public') AS visibility,
+				COUNT { (:User)-[:REPOSTED]->(p) } AS repostCount,
+				COUNT { (:Post)-[:QUOTES]->(p) } AS quoteCount,
+				quoted.id AS quotedPostId
+			ORDER BY p.createdAt DESC
+		`, viewerParams(viewer, map[string]any{"userId": userId}))
+		if err != nil {
+			return nil, err
+		}
+
+		var posts []FeedPost
+		for records.Next(context.Background()) {
+			posts = append(posts, feedPostFrom(records.Record()))
+		}
+		return posts, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]FeedPost), nil
+}
+
+// CountFollowers counts the number of followers for a user
+func (c *Neo4jClient) CountFollowers(userId string) (int, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (follower:User)-[:FOLLOWS]->(u:User {id: $userId})
+			RETURN count(follower) AS followerCount
+		`, map[string]any{"userId": userId})
+		if err != nil {
+			return 0, err
+		}
+
+		if !result.Next(context.Background()) {
+			return 0, nil
+		}
+
+		record := result.Record()
+		count, _ := record.Get("followerCount")
+		return int(count.(int64)), nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.(int), nil
+}
+
+// CountFollowing counts the number of users a user is following
+func (c *Neo4jClient) CountFollowing(userId string) (int, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})-[:FOLLOWS]->(followed:User)
+			RETURN count(followed) AS followingCount
+		`, map[string]any{"userId": userId})
+		if err != nil {
+			return 0, err
+		}
+
+		if !result.Next(context.Background()) {
+			return 0, nil
+		}
+
+		record := result.Record()
+		count, _ := record.Get("followingCount")
+		return int(count.(int64)), nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
 
 	return result.(int), nil
 }
@@ -1110,14 +2748,409 @@ func (c *Neo4jClient) UnfollowUser(userId, targetUserId string) error {
 
 	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
 		_, err := tx.Run(context.Background(), `
-			MATCH (u1:User {id: $userId})-[f:FOLLOWS]->(u2:User {id: $targetUserId})
+			MATCH (u1:User {id: $userId})-[f:FOLLOWS|FOLLOW_REQUEST]->(u2:User {id: $targetUserId})
+			DELETE f
+		`, map[string]any{
+			"userId":       userId,
+			"targetUserId": targetUserId,
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+// BlockUser makes the two users invisible to each other and drops any follows
+// between them
+func (c *Neo4jClient) BlockUser(userId, targetUserId string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	params := map[string]any{
+		"userId":       userId,
+		"targetUserId": targetUserId,
+		"createdAt":    time.Now().UTC().Format(time.RFC3339),
+	}
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireUser(tx, targetUserId); err != nil {
+			return nil, err
+		}
+
+		statements := []string{`
+			MATCH (u1:User {id: $userId})
+			MATCH (u2:User {id: $targetUserId})
+			MERGE (u1)-[b:BLOCKS]->(u2)
+			ON CREATE SET b.createdAt = $createdAt
+		`, `
+			MATCH (:User {id: $userId})-[f:FOLLOWS|FOLLOW_REQUEST]-(:User {id: $targetUserId})
 			DELETE f
+		`}
+		for _, stmt := range statements {
+			if _, err := tx.Run(context.Background(), stmt, params); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+
+	return err
+}
+
+func (c *Neo4jClient) UnblockUser(userId, targetUserId string) error {
+	return c.deleteUserRelation("BLOCKS", userId, targetUserId)
+}
+
+func (c *Neo4jClient) GetFollowRequests(userId string) ([]UserSummary, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			MATCH (x:User)-[r:FOLLOW_REQUEST]->(:User {id: $userId})
+			RETURN x.id AS id, x.username AS username, coalesce(x.displayName, x.username) AS displayName,
+			       x.avatarUrl AS avatarUrl
+			ORDER BY r.createdAt
+		`, map[string]any{"userId": userId})
+		if err != nil {
+			return nil, err
+		}
+
+		users := []UserSummary{}
+		for records.Next(context.Background()) {
+			users = append(users, userSummaryFrom(records.Record()))
+		}
+		return users, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]UserSummary), nil
+}
+
+// ApproveFollowRequest turns requesterId's pending request into a follow
+func (c *Neo4jClient) ApproveFollowRequest(userId, requesterId string) error {
+	return c.resolveFollowRequest(userId, requesterId, `
+		MATCH (requester:User {id: $requesterId})-[r:FOLLOW_REQUEST]->(u:User {id: $userId})
+		MERGE (requester)-[:FOLLOWS]->(u)
+		DELETE r
+		RETURN count(*) AS resolved
+	`)
+}
+
+func (c *Neo4jClient) DenyFollowRequest(userId, requesterId string) error {
+	return c.resolveFollowRequest(userId, requesterId, `
+		MATCH (:User {id: $requesterId})-[r:FOLLOW_REQUEST]->(:User {id: $userId})
+		DELETE r
+		RETURN count(*) AS resolved
+	`)
+}
+
+// resolveFollowRequest runs query against a pending request and fails with a
+// *NotFoundError if there wasn't one
+func (c *Neo4jClient) resolveFollowRequest(userId, requesterId, query string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), query, map[string]any{
+			"userId":      userId,
+			"requesterId": requesterId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if resolved, _ := record.Get("resolved"); resolved.(int64) == 0 {
+			return nil, &NotFoundError{Kind: "follow request", ID: requesterId}
+		}
+		return nil, nil
+	})
+
+	return err
+}
+
+func (c *Neo4jClient) GetBlockedUsers(userId string) ([]UserSummary, error) {
+	return c.getRelatedUsers("BLOCKS", userId)
+}
+
+// MuteUser hides the target's posts from the user's feed. Unlike a block the
+// target isn't told and nothing else changes.
+func (c *Neo4jClient) MuteUser(userId, targetUserId string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+		if err := requireUser(tx, targetUserId); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Run(context.Background(), `
+			MATCH (u1:User {id: $userId})
+			MATCH (u2:User {id: $targetUserId})
+			MERGE (u1)-[m:MUTES]->(u2)
+			ON CREATE SET m.createdAt = $createdAt
 		`, map[string]any{
 			"userId":       userId,
 			"targetUserId": targetUserId,
+			"createdAt":    time.Now().UTC().Format(time.RFC3339),
 		})
 		return nil, err
 	})
 
 	return err
 }
+
+func (c *Neo4jClient) UnmuteUser(userId, targetUserId string) error {
+	return c.deleteUserRelation("MUTES", userId, targetUserId)
+}
+
+func (c *Neo4jClient) GetMutedUsers(userId string) ([]UserSummary, error) {
+	return c.getRelatedUsers("MUTES", userId)
+}
+
+func (c *Neo4jClient) GetEmotionFilters(userId string) ([]EmotionFilter, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			MATCH (:User {id: $userId})-[f:FILTERS]->(e:Emotion)
+			WHERE f.until IS NULL OR f.until > $now
+			RETURN e.type AS emotion, f.minScore AS minScore, f.until AS until
+			ORDER BY emotion
+		`, map[string]any{
+			"userId": userId,
+			"now":    time.Now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		filters := []EmotionFilter{}
+		for records.Next(context.Background()) {
+			record := records.Record()
+			emotion, _ := record.Get("emotion")
+			minScore, _ := record.Get("minScore")
+			until, _ := record.Get("until")
+
+			filter := EmotionFilter{
+				Emotion:  emotion.(string),
+				MinScore: minScore.(float64),
+			}
+			filter.Until, _ = until.(string)
+			filters = append(filters, filter)
+		}
+		return filters, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]EmotionFilter), nil
+}
+
+func (c *Neo4jClient) SetEmotionFilter(userId string, filter EmotionFilter) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	var until any
+	if filter.Until != "" {
+		until = filter.Until
+	}
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		if err := requireUser(tx, userId); err != nil {
+			return nil, err
+		}
+
+		_, err := tx.Run(context.Background(), `
+			MATCH (u:User {id: $userId})
+			MERGE (e:Emotion {type: $emotion})
+			MERGE (u)-[f:FILTERS]->(e)
+			SET f.emotion = $emotion, f.minScore = $minScore, f.until = $until, f.updatedAt = $now
+		`, map[string]any{
+			"userId":   userId,
+			"emotion":  filter.Emotion,
+			"minScore": filter.MinScore,
+			"until":    until,
+			"now":      time.Now().UTC().Format(time.RFC3339),
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+func (c *Neo4jClient) DeleteEmotionFilter(userId, emotion string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(context.Background(), `
+			MATCH (:User {id: $userId})-[f:FILTERS]->(:Emotion {type: $emotion})
+			DELETE f
+		`, map[string]any{
+			"userId":  userId,
+			"emotion": emotion,
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+// deleteUserRelation removes a BLOCKS or MUTES relationship; relType is
+// never user input
+func (c *Neo4jClient) deleteUserRelation(relType, userId, targetUserId string) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(context.Background(), `
+			MATCH (:User {id: $userId})-[r:`+relType+`]->(:User {id: $targetUserId})
+			DELETE r
+		`, map[string]any{
+			"userId":       userId,
+			"targetUserId": targetUserId,
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+// getRelatedUsers lists the users a user has blocked or muted, most recent
+// first
+func (c *Neo4jClient) getRelatedUsers(relType, userId string) ([]UserSummary, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(context.Background(), `
+			MATCH (:User {id: $userId})-[r:`+relType+`]->(x:User)
+			RETURN x.id AS id, x.username AS username, coalesce(x.displayName, x.username) AS displayName,
+			       x.avatarUrl AS avatarUrl
+			ORDER BY r.createdAt DESC
+		`, map[string]any{"userId": userId})
+		if err != nil {
+			return nil, err
+		}
+
+		users := []UserSummary{}
+		for records.Next(context.Background()) {
+			users = append(users, userSummaryFrom(records.Record()))
+		}
+		return users, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]UserSummary), nil
+}
+
+// GetCachedAnalysis returns a stored emotion analysis result unless it has expired
+func (c *Neo4jClient) GetCachedAnalysis(key string) ([]byte, time.Duration, bool, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	type cached struct {
+		value []byte
+		ttl   time.Duration
+	}
+	result, err := session.ExecuteRead(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		rec, err := tx.Run(context.Background(), `
+			MATCH (a:AnalysisCache {key: $key})
+			WHERE a.expiresAt > timestamp()
+			RETURN a.value AS value, a.expiresAt - timestamp() AS ttlMillis
+		`, map[string]any{"key": key})
+		if err != nil {
+			return nil, err
+		}
+		if !rec.Next(context.Background()) {
+			return nil, nil // Not cached
+		}
+
+		value, _ := rec.Record().Get("value")
+		ttlMillis, _ := rec.Record().Get("ttlMillis")
+		return cached{
+			value: []byte(value.(string)),
+			ttl:   time.Duration(ttlMillis.(int64)) * time.Millisecond,
+		}, nil
+	})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if result == nil {
+		return nil, 0, false, nil
+	}
+	hit := result.(cached)
+	return hit.value, hit.ttl, true, nil
+}
+
+// PutCachedAnalysis stores an emotion analysis result for ttl, replacing any
+// previous (possibly expired) entry under the same key
+func (c *Neo4jClient) PutCachedAnalysis(key string, value []byte, ttl time.Duration) error {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(context.Background(), `
+			MERGE (a:AnalysisCache {key: $key})
+			SET a.value = $value,
+			    a.expiresAt = timestamp() + $ttlMillis
+		`, map[string]any{
+			"key":       key,
+			"value":     string(value),
+			"ttlMillis": ttl.Milliseconds(),
+		})
+		return nil, err
+	})
+
+	return err
+}
+
+// pruneBatchSize bounds how many nodes one pruning transaction deletes
+const pruneBatchSize = 10000
+
+// DeleteExpiredCachedAnalyses deletes expired emotion analysis results in
+// batches and returns how many were removed
+func (c *Neo4jClient) DeleteExpiredCachedAnalyses() (int, error) {
+	session := c.driver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	total := 0
+	for {
+		result, err := session.ExecuteWrite(context.Background(), func(tx neo4j.ManagedTransaction) (any, error) {
+			rec, err := tx.Run(context.Background(), `
+				MATCH (a:AnalysisCache) WHERE a.expiresAt < timestamp()
+				WITH a LIMIT $batchSize
+				DETACH DELETE a
+				RETURN count(*) AS deleted
+			`, map[string]any{"batchSize": pruneBatchSize})
+			if err != nil {
+				return nil, err
+			}
+			record, err := rec.Single(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			deleted, _ := record.Get("deleted")
+			return int(deleted.(int64)), nil
+		})
+		if err != nil {
+			return total, err
+		}
+		deleted := result.(int)
+		total += deleted
+		if deleted < pruneBatchSize {
+			return total, nil
+		}
+	}
+}
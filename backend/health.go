@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// handleHealthz reports that the process is up and serving
+func handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+	}
+}
+
+// handleReadyz reports whether the dependencies needed to serve traffic are
+// reachable. It fails as soon as shutdown starts so load balancers drain us.
+func handleReadyz(client graphdb.GraphDbClient, emotion *emotionAPI, draining *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		defer cancel()
+
+		status := http.StatusOK
+		resp := HealthResponse{Status: "ready", Checks: map[string]string{}}
+
+		if draining.Load() {
+			status = http.StatusServiceUnavailable
+			resp.Checks["server"] = "shutting down"
+		}
+		if err := client.VerifyConnectivity(ctx); err != nil {
+			status = http.StatusServiceUnavailable
+			resp.Checks["neo4j"] = err.Error()
+		} else {
+			resp.Checks["neo4j"] = "ok"
+		}
+		if err := emotion.ping(ctx); err != nil {
+			status = http.StatusServiceUnavailable
+			resp.Checks["emotion"] = err.Error()
+		} else {
+			resp.Checks["emotion"] = "ok"
+		}
+
+		if status != http.StatusOK {
+			resp.Status = "unavailable"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,113 @@
+// Package mail sends transactional email such as verification and password
+// reset links.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/google/uuid"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.Backend
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Backend {
+	case "log":
+		return Log{}, nil
+	case "smtp":
+		return NewSMTP(cfg)
+	default:
+		return nil, fmt.Errorf("mail: unknown backend %q", cfg.Backend)
+	}
+}
+
+// Log writes messages to the log instead of sending them. Links in the
+// body are usable as-is, which is handy in development.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	slog.Default().InfoContext(ctx, "mail not sent (log backend)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// SMTP sends messages through an SMTP server, upgrading to TLS with
+// STARTTLS when the server offers it
+type SMTP struct {
+	addr string
+	host string
+	from *mail.Address
+	auth smtp.Auth
+}
+
+func NewSMTP(cfg config.Mail) (*SMTP, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid from address: %w", err)
+	}
+	s := &SMTP{
+		addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+		host: cfg.SMTP.Host,
+		from: from,
+	}
+	if cfg.SMTP.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return s, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	// Addresses end up in headers; refuse anything that could inject more
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return fmt.Errorf("mail: invalid address %q", msg.To)
+	}
+
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	qp.Write([]byte(msg.Body))
+	qp.Close()
+
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&data, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&data, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&data, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&data, "Message-ID: <%s@%s>\r\n", uuid.New().String(), s.host)
+	data.WriteString("MIME-Version: 1.0\r\n")
+	data.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	data.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	data.Write(body.Bytes())
+
+	// net/smtp has no context support; run it so callers can stop waiting
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.addr, s.auth, s.from.Address, []string{msg.To}, data.Bytes())
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
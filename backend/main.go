@@ -1,24 +1,43 @@
 package main
 
 import (
-	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/HarutoKitagawa/emotional_sns/backend/apispec"
+	"github.com/HarutoKitagawa/emotional_sns/backend/blob"
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
 	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/mail"
+	"github.com/HarutoKitagawa/emotional_sns/backend/ratelimit"
+	"github.com/HarutoKitagawa/emotional_sns/backend/taxonomy"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// JWT secret key
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// JWT secret key, set from the configuration at startup
+var jwtSecret []byte
 
 type PostRequest struct {
 	UserID  string `json:"userId"`
 	Content string `json:"content"`
+	// Visibility defaults to public
+	Visibility string `json:"visibility"`
+	// QuotedPostID makes this a quote post of another public post
+	QuotedPostID string `json:"quotedPostId"`
 }
 
 type EmotionResponse struct {
@@ -38,6 +57,7 @@ type GetPostResponse struct {
 	CreatedAt      string               `json:"createdAt"`
 	EmotionTags    []graphdb.EmotionTag `json:"emotionTags"`
 	ReactionCounts map[string]int       `json:"reactionCounts"`
+	Visibility     string               `json:"visibility"`
 }
 
 type ReactionRequest struct {
@@ -45,11 +65,21 @@ type ReactionRequest struct {
 	Type   string `json:"type"`
 }
 
+type RepostRequest struct {
+	UserID string `json:"userId"`
+}
+
 type ReplyRequest struct {
 	UserID  string `json:"userId"`
 	Content string `json:"content"`
+	// ParentReplyID, if set, answers that reply instead of the post
+	ParentReplyID string `json:"parentReplyId"`
 }
 
+// replyContextDepth is how many of the replies above a new reply are sent
+// to emotion analysis along with the post
+const replyContextDepth = 5
+
 type ReplyResponse struct {
 	ReplyID string `json:"replyId"`
 	Status  string `json:"status"`
@@ -67,6 +97,32 @@ type EmotionTagsResponse struct {
 	EmotionTags []graphdb.EmotionTagOnly `json:"emotionTags"`
 }
 
+type EmotionTagStats struct {
+	Type         string  `json:"type"`
+	UsageCount   int     `json:"usageCount"`
+	AverageScore float64 `json:"averageScore"`
+	LastUsedAt   string  `json:"lastUsedAt,omitempty"`
+	RecentCount  int     `json:"recentCount"`
+	Trend        int     `json:"trend"` // recentCount minus the count in the window before
+}
+
+type EmotionTagStatsResponse struct {
+	EmotionTags []EmotionTagStats `json:"emotionTags"`
+	WindowDays  int               `json:"windowDays"`
+}
+
+// emotionTagSorts are the orders accepted by GET /emotion-tags?sort=
+var emotionTagSorts = map[string]func(a, b graphdb.EmotionTagStats) int{
+	"type":     func(a, b graphdb.EmotionTagStats) int { return cmp.Compare(a.Type, b.Type) },
+	"usage":    func(a, b graphdb.EmotionTagStats) int { return cmp.Compare(b.UsageCount, a.UsageCount) },
+	"recent":   func(a, b graphdb.EmotionTagStats) int { return cmp.Compare(b.RecentCount, a.RecentCount) },
+	"score":    func(a, b graphdb.EmotionTagStats) int { return cmp.Compare(b.AverageScore, a.AverageScore) },
+	"lastUsed": func(a, b graphdb.EmotionTagStats) int { return b.LastUsedAt.Compare(a.LastUsedAt) },
+	"trending": func(a, b graphdb.EmotionTagStats) int {
+		return cmp.Compare(b.RecentCount-b.PreviousCount, a.RecentCount-a.PreviousCount)
+	},
+}
+
 type FollowRequest struct {
 	TargetUserID string `json:"targetUserId"`
 }
@@ -97,10 +153,21 @@ type RegisterRequest struct {
 }
 
 type LoginRequest struct {
+	// Login is an email address or a username. Email is still accepted for
+	// older clients.
+	Login    string `json:"login"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+// identifier returns whichever of login or email the client sent
+func (r LoginRequest) identifier() string {
+	if r.Login != "" {
+		return r.Login
+	}
+	return r.Email
+}
+
 type AuthResponse struct {
 	UserID   string `json:"userId"`
 	Username string `json:"username"`
@@ -109,26 +176,155 @@ type AuthResponse struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cleanup-phantom-users" {
+		os.Exit(runPhantomUserCleanup(os.Args[2:]))
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+
+	logger := newLogger(cfg.Log)
+	slog.SetDefault(logger)
+
 	// Initialize Neo4j client
-	client, err := graphdb.NewNeo4jClient(os.Getenv("NEO4J_URI"), "neo4j", "password")
+	client, err := graphdb.NewNeo4jClient(cfg.Neo4j)
 	if err != nil {
-		log.Fatal("Failed to create Neo4j client:", err)
+		logger.Error("failed to create Neo4j client", "err", err)
+		os.Exit(1)
 	}
 	defer client.Close()
+	client = graphdb.NewInstrumentedClient(client, observeNeo4jQuery)
+
+	if err := client.EnsureSchema(); err != nil {
+		logger.Warn("some database schema statements failed", "err", err)
+	}
+
+	// Make sure the canonical emotions and their hierarchy exist
+	if err := client.SyncEmotionTaxonomy(taxonomy.Definitions()); err != nil {
+		logger.Warn("failed to sync emotion taxonomy", "err", err)
+	}
 
 	// Set JWT secret
-	if os.Getenv("JWT_SECRET") == "" {
-		log.Println("Warning: JWT_SECRET not set, using default secret")
-		jwtSecret = []byte("default_secret_key_for_development")
+	if cfg.JWTSecret == config.DefaultJWTSecret {
+		logger.Warn("JWT_SECRET not set, using default secret")
+	}
+	jwtSecret = []byte(cfg.JWTSecret)
+
+	emotion := newEmotionAPI(cfg.Emotion, client)
+	workers := newBackgroundWorkers()
+	if emotion.cache != nil && emotion.cache.store != nil {
+		workers.Every(context.Background(), emotionCachePruneInterval, emotion.cache.prune)
+	}
+	var draining atomic.Bool
+
+	var lockout *ratelimit.Lockout
+	if cfg.RateLimit.Enabled {
+		lockout = ratelimit.NewLockout(cfg.RateLimit.LockoutThreshold, cfg.RateLimit.LockoutWindow, cfg.RateLimit.LockoutDuration)
+	}
+
+	store, err := blob.New(cfg.Blob)
+	if err != nil {
+		logger.Error("failed to create blob store", "backend", cfg.Blob.Backend, "err", err)
+		os.Exit(1)
+	}
+	avatars := newAvatarUploads(store, cfg.Avatar)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		logger.Error("failed to create mailer", "backend", cfg.Mail.Backend, "err", err)
+		os.Exit(1)
+	}
+	if cfg.IsProduction() && cfg.Mail.Backend == "log" {
+		logger.Warn("mail backend is log; verification and password reset emails are not sent")
+	}
+	accounts := newAccountFlows(cfg.Account, mailer, workers)
+
+	var handler http.Handler = newRouter(client, emotion, workers, lockout, avatars, accounts, cfg.AdminToken)
+
+	// Validate requests and responses against the OpenAPI spec in development
+	if !cfg.IsProduction() {
+		validator, err := apispec.Load(cfg.OpenAPISpec)
+		if err != nil {
+			logger.Error("failed to load OpenAPI spec", "path", cfg.OpenAPISpec, "err", err)
+			os.Exit(1)
+		}
+		validator.Logger = loggerFrom
+		handler = validator.Middleware(handler)
+		logger.Info("OpenAPI validation enabled", "path", cfg.OpenAPISpec)
 	}
 
+	// Rate limit before validation so rejected clients cost as little as possible
+	if cfg.RateLimit.Enabled {
+		handler = newRateLimits(cfg.RateLimit).middleware(handler)
+	} else {
+		logger.Warn("rate limiting disabled")
+	}
+
+	root := http.NewServeMux()
+	root.Handle("/metrics", promhttp.Handler())
+	root.Handle("/healthz", handleHealthz())
+	root.Handle("/readyz", handleReadyz(client, emotion, &draining))
+	if local, ok := store.(*blob.Local); ok {
+		root.Handle(local.URLPrefix(), local)
+	}
+	root.Handle("/", withMetrics(handler))
+
+	server := &http.Server{
+		Addr:    cfg.ListenAddr,
+		Handler: withRequestID(withAccessLog(root)),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server started", "addr", cfg.ListenAddr, "env", cfg.Env)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		logger.Error("server stopped", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Fail readiness, stop accepting connections and let in-flight requests
+	// and background jobs finish before closing the database driver
+	logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to drain HTTP requests", "err", err)
+	}
+	if err := workers.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to drain background jobs", "err", err)
+	}
+	logger.Info("server stopped")
+}
+
+// newRouter registers every API endpoint on a fresh mux
+func newRouter(client graphdb.GraphDbClient, emotion *emotionAPI, workers *backgroundWorkers, lockout *ratelimit.Lockout, avatars *avatarUploads, accounts *accountFlows, adminToken string) *http.ServeMux {
+	mux := http.NewServeMux()
+
 	// Post related endpoints
-	http.HandleFunc("/posts", handleCreatePost(client))
-	http.HandleFunc("/posts/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/posts", handleCreatePost(client, emotion, workers))
+	mux.HandleFunc("/posts/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
 		switch {
+		case len(parts) == 5 && parts[2] == "replies" && parts[4] == "reactions":
+			// Route: /posts/{postId}/replies/{replyId}/reactions
+			handleAddReplyReaction(client)(w, r)
 		case strings.HasSuffix(r.URL.Path, "/replies"):
 			if r.Method == http.MethodPost {
-				handleAddReply(client)(w, r)
+				handleAddReply(client, emotion)(w, r)
 			} else if r.Method == http.MethodGet {
 				handleGetReplies(client)(w, r)
 			} else {
@@ -136,19 +332,28 @@ func main() {
 			}
 		case strings.HasSuffix(r.URL.Path, "/reactions"):
 			handleAddReaction(client)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/reposts"):
+			handleRepost(client)(w, r)
 		case strings.HasSuffix(r.URL.Path, "/influence"):
 			handleGetPostInfluence(client)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/emotions"):
+			handleCorrectPostEmotions(client)(w, r)
 		default:
 			handleGetPost(client)(w, r)
 		}
 	})
 
 	// User related endpoints
-	http.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/users", handleSearchUsers(client))
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
 		path := strings.Trim(r.URL.Path, "/")
 		parts := strings.Split(path, "/")
 
 		switch {
+		case len(parts) == 3 && parts[0] == "users" && parts[1] == "by-username":
+			// Route: /users/by-username/{username}, matched first so usernames
+			// like "feed" can't be mistaken for subresources
+			handleGetUserByUsername(client)(w, r)
 		case strings.HasSuffix(r.URL.Path, "/feed"):
 			handleUserFeed(client)(w, r)
 		case strings.HasSuffix(r.URL.Path, "/follow"):
@@ -157,6 +362,22 @@ func main() {
 			handleUserPosts(client)(w, r)
 		case strings.HasSuffix(r.URL.Path, "/followers"):
 			handleUserFollowers(client)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/suggestions"):
+			handleUserSuggestions(client)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/avatar"):
+			handleAvatar(client, avatars)(w, r)
+		case len(parts) >= 3 && parts[2] == "follow-requests":
+			// Routes: /users/{userId}/follow-requests,
+			// /users/{userId}/follow-requests/{requesterId}/{approve,deny}
+			handleFollowRequests(client)(w, r)
+		case len(parts) >= 3 && parts[2] == "blocks":
+			// Routes: /users/{userId}/blocks, /users/{userId}/blocks/{targetId}
+			handleUserRelation(blockRelation(client))(w, r)
+		case len(parts) >= 3 && parts[2] == "mutes":
+			handleUserRelation(muteRelation(client))(w, r)
+		case len(parts) >= 3 && parts[2] == "emotion-filters":
+			// Routes: /users/{userId}/emotion-filters, /users/{userId}/emotion-filters/{emotion}
+			handleEmotionFilters(client)(w, r)
 		case len(parts) == 4 && parts[0] == "users" && parts[2] == "following":
 			// Route: /users/{userId}/following/{targetId}
 			handleUnfollowUser(client)(w, r)
@@ -166,7 +387,14 @@ func main() {
 		default:
 			// Check if it's a direct user ID request
 			if len(parts) == 2 && parts[0] == "users" {
-				handleGetUser(client)(w, r)
+				switch r.Method {
+				case http.MethodPatch:
+					handleUpdateProfile(client)(w, r)
+				case http.MethodDelete:
+					handleDeleteUser(client, avatars)(w, r)
+				default:
+					handleGetUser(client)(w, r)
+				}
 			} else {
 				http.NotFound(w, r)
 			}
@@ -174,18 +402,68 @@ func main() {
 	})
 
 	// Auth related endpoints
-	http.HandleFunc("/auth/register", handleRegister(client))
-	http.HandleFunc("/auth/login", handleLogin(client))
-	http.HandleFunc("/auth/me", handleGetCurrentUser(client))
+	mux.HandleFunc("/auth/register", handleRegister(client, accounts))
+	mux.HandleFunc("/auth/login", handleLogin(client, lockout, accounts))
+	mux.HandleFunc("/auth/me", handleGetCurrentUser(client))
+	mux.HandleFunc("/auth/verify-email", handleVerifyEmail(client))
+	mux.HandleFunc("/auth/verify-email/resend", handleResendVerification(client, accounts))
+	mux.HandleFunc("/auth/password/change", handleChangePassword(client))
+	mux.HandleFunc("/auth/password/reset/request", handleRequestPasswordReset(client, accounts))
+	mux.HandleFunc("/auth/password/reset", handleResetPassword(client))
 
 	// Other endpoints
-	http.HandleFunc("/emotion-tags", handleGetAllEmotionTags(client))
+	mux.HandleFunc("/emotion-tags", handleGetAllEmotionTags(client))
+	mux.HandleFunc("/search", handleSearch(client))
 
-	fmt.Println("🚀 Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Admin endpoints
+	mux.HandleFunc("/admin/emotions/merge", requireAdmin(adminToken, handleMergeEmotions(client)))
+	mux.HandleFunc("/admin/emotion-corrections", requireAdmin(adminToken, handleExportEmotionCorrections(client)))
+	mux.HandleFunc("/admin/phantom-users", requireAdmin(adminToken, handlePhantomUsers(client)))
+
+	return mux
 }
 
-func handleCreatePost(client graphdb.GraphDbClient) http.HandlerFunc {
+// writeIfNotFound answers 404 and returns true when err reports a missing
+// user or post
+func writeIfNotFound(w http.ResponseWriter, err error) bool {
+	var nf *graphdb.NotFoundError
+	if !errors.As(err, &nf) {
+		return false
+	}
+	http.Error(w, strings.ToUpper(nf.Kind[:1])+nf.Kind[1:]+" not found", http.StatusNotFound)
+	return true
+}
+
+// viewerFrom builds the viewer a listing is for from their user ID, empty
+// for anonymous readers, and the showFiltered query parameter that bypasses
+// their emotion filters
+func viewerFrom(r *http.Request, viewerId string) (graphdb.Viewer, validation.Errors) {
+	v := validation.New()
+	showFiltered := v.Bool("showFiltered", r.URL.Query().Get("showFiltered"))
+	return graphdb.Viewer{ID: viewerId, ShowFiltered: showFiltered}, v.Errors()
+}
+
+// writeIfBlocked answers 403 and returns true when err reports a block
+// between the two users involved
+func writeIfBlocked(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, graphdb.ErrBlocked) {
+		return false
+	}
+	http.Error(w, "You can't interact with this user", http.StatusForbidden)
+	return true
+}
+
+// writeIfNotShareable answers 403 and returns true when err reports a post
+// that can't be reposted or quoted
+func writeIfNotShareable(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, graphdb.ErrNotShareable) {
+		return false
+	}
+	http.Error(w, "Only public posts can be shared", http.StatusForbidden)
+	return true
+}
+
+func handleCreatePost(client graphdb.GraphDbClient, emotion *emotionAPI, workers *backgroundWorkers) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -193,51 +471,68 @@ func handleCreatePost(client graphdb.GraphDbClient) http.HandlerFunc {
 		}
 
 		var req PostRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" || req.Content == "" {
-			http.Error(w, "Missing userId or content", http.StatusBadRequest)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+
+		// A quote post is analyzed in the context of the post it quotes. Only
+		// public posts can be quoted, so check that before the analysis call.
+		var quoted string
+		if req.QuotedPostID != "" {
+			content, err := client.GetShareablePostContent(req.QuotedPostID, req.UserID)
+			if err != nil {
+				if writeIfNotFound(w, err) || writeIfBlocked(w, err) || writeIfNotShareable(w, err) {
+					return
+				}
+				logger.Error("failed to get quoted post", "post_id", req.QuotedPostID, "err", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			quoted = content
+		}
 
 		// Call emotion analysis API
-		emotions, err := analyzeEmotionOfPost(req.Content)
+		rawEmotions, err := emotion.analyzeEmotionOfPost(r.Context(), req.Content, quoted)
 		if err != nil {
-			http.Error(w, "Emotion analysis failed", http.StatusInternalServerError)
+			logger.Error("emotion analysis failed", "endpoint", "analyze_post", "err", err)
+			writeEmotionError(w, err)
 			return
 		}
-		log.Printf("Emotions: %v", emotions)
+		emotions := emotion.selectTags(r.Context(), rawEmotions)
+		logger.Debug("post emotions analyzed", "raw", rawEmotions, "emotions", emotions)
 
 		// Create post in Neo4j
 		postId := uuid.New().String()
-		err = client.CreatePostWithEmotions(req.UserID, postId, req.Content, emotions)
+		visibility := cmp.Or(req.Visibility, "public")
+		err = client.CreatePostWithEmotions(req.UserID, postId, req.Content, visibility, req.QuotedPostID, emotions, rawEmotions)
 		if err != nil {
-			log.Printf("Failed to create post in database: %v", err)
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) || writeIfNotShareable(w, err) {
+				return
+			}
+			logger.Error("failed to create post", "user_id", req.UserID, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		postsCreated.Inc()
 
-		// 過去24時間に影響を受けた投稿を取得
-		influencedPosts, err := client.GetInfluencedPostsLast24Hours(req.UserID)
-		if err != nil {
-			log.Printf("Failed to get influenced posts: %v", err)
-			// エラーがあっても処理は続行
-		} else {
-			// 各投稿について、同じトピックかどうかを判断
-			for _, post := range influencedPosts {
-				isSameTopic, err := analyzeTopicSimilarity(req.Content, post.Content)
-				if err != nil {
-					log.Printf("Failed to analyze topic similarity: %v", err)
-					continue
-				}
-
-				if isSameTopic {
-					// 同じトピックであれば、SAME_TOPICリレーションを作成
-					if err := client.AddSameTopicRelation(postId, post.PostID); err != nil {
-						log.Printf("Failed to add SAME_TOPIC relation: %v", err)
-					}
-				}
+		if req.QuotedPostID != "" {
+			if err := client.AddInfluence(req.UserID, req.QuotedPostID, "quote"); err != nil {
+				logger.Error("failed to register influence", "post_id", req.QuotedPostID, "user_id", req.UserID, "err", err)
 			}
 		}
 
+		// トピック類似度の判定はLLM呼び出しが多いのでバックグラウンドで行う
+		workers.Go(r.Context(), func(ctx context.Context) {
+			linkSameTopicPosts(ctx, client, emotion, req.UserID, postId, req.Content)
+		})
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(PostResponse{
@@ -247,12 +542,53 @@ func handleCreatePost(client graphdb.GraphDbClient) http.HandlerFunc {
 	}
 }
 
+// linkSameTopicPosts adds SAME_TOPIC relations from a new post to the posts
+// that influenced its author in the last 24 hours
+func linkSameTopicPosts(ctx context.Context, client graphdb.GraphDbClient, emotion *emotionAPI, userId, postId, content string) {
+	logger := loggerFrom(ctx)
+
+	// 過去24時間に影響を受けた投稿を取得
+	influencedPosts, err := client.GetInfluencedPostsLast24Hours(userId)
+	if err != nil {
+		logger.Error("failed to get influenced posts", "user_id", userId, "err", err)
+		return
+	}
+
+	// 各投稿について、同じトピックかどうかを判断
+	for _, post := range influencedPosts {
+		if ctx.Err() != nil {
+			return
+		}
+		isSameTopic, err := emotion.analyzeTopicSimilarity(ctx, content, post.Content)
+		if err != nil {
+			logger.Error("emotion analysis failed", "endpoint", "analyze_topic_similarity", "post_id", post.PostID, "err", err)
+			continue
+		}
+
+		if isSameTopic {
+			// 同じトピックであれば、SAME_TOPICリレーションを作成
+			if err := client.AddSameTopicRelation(postId, post.PostID); err != nil {
+				logger.Error("failed to add SAME_TOPIC relation", "post_id", postId, "target_post_id", post.PostID, "err", err)
+			}
+		}
+	}
+}
+
 func handleGetPost(client graphdb.GraphDbClient) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		postId := strings.TrimPrefix(r.URL.Path, "/posts/")
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
-		userId, content, createdAt, emotions, err := client.GetPostWithEmotions(postId)
+		viewerId, _ := authenticatedUserID(r)
+		userId, content, createdAt, visibility, emotions, err := client.GetPostWithEmotions(postId, graphdb.Viewer{ID: viewerId})
 		if err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			loggerFrom(r.Context()).Error("failed to get post", "post_id", postId, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
@@ -274,6 +610,7 @@ func handleGetPost(client graphdb.GraphDbClient) http.HandlerFunc {
 			EmotionTags:    emotions,
 			CreatedAt:      createdAt,
 			ReactionCounts: reactions,
+			Visibility:     visibility,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -291,37 +628,136 @@ func handleAddReaction(client graphdb.GraphDbClient) http.HandlerFunc {
 		postId := strings.TrimPrefix(r.URL.Path, "/posts/") // 超簡易ルーティング
 		postId = strings.TrimSuffix(postId, "/reactions")
 
-		var req ReactionRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" || req.Type == "" {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
 			return
 		}
 
-		// 簡易バリデーション
-		validTypes := map[string]bool{"like": true, "love": true, "cry": true, "angry": true, "wow": true}
-		if !validTypes[req.Type] {
-			http.Error(w, "Invalid reaction type", http.StatusBadRequest)
+		var req ReactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
 			return
 		}
 
+		logger := loggerFrom(r.Context())
 		if err := client.AddReaction(postId, req.UserID, req.Type); err != nil {
-			log.Printf("Failed to add reaction: %v", err)
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+				return
+			}
+			logger.Error("failed to add reaction", "post_id", postId, "user_id", req.UserID, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		reactionsAdded.WithLabelValues(req.Type).Inc()
 
 		// Register influence
 		if err := client.AddInfluence(req.UserID, postId, req.Type); err != nil {
-			log.Printf("Failed to register influence: %v", err)
+			logger.Error("failed to register influence", "post_id", postId, "user_id", req.UserID, "err", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "reaction added"})
+	}
+}
+
+// handleRepost shares a public post with the caller's followers
+func handleRepost(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		postId := strings.TrimPrefix(r.URL.Path, "/posts/")
+		postId = strings.TrimSuffix(postId, "/reposts")
+
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		var req RepostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+		if err := client.Repost(postId, req.UserID); err != nil {
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) || writeIfNotShareable(w, err) {
+				return
+			}
+			logger.Error("failed to repost", "post_id", postId, "user_id", req.UserID, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := client.AddInfluence(req.UserID, postId, "repost"); err != nil {
+			logger.Error("failed to register influence", "post_id", postId, "user_id", req.UserID, "err", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "reposted"})
+	}
+}
+
+// handleAddReplyReaction reacts to a reply. Unlike reactions to posts these
+// don't count as influence.
+func handleAddReplyReaction(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 5 || parts[0] != "posts" || parts[2] != "replies" || parts[4] != "reactions" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		postId, replyId := parts[1], parts[3]
+		if errs := validatePathIDs("postId", postId, "replyId", replyId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		var req ReactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
 		}
 
+		if err := client.AddReplyReaction(postId, replyId, req.UserID, req.Type); err != nil {
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+				return
+			}
+			loggerFrom(r.Context()).Error("failed to add reply reaction", "post_id", postId, "reply_id", replyId, "user_id", req.UserID, "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		reactionsAdded.WithLabelValues(req.Type).Inc()
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]string{"status": "reaction added"})
 	}
 }
 
-func handleAddReply(client graphdb.GraphDbClient) http.HandlerFunc {
+func handleAddReply(client graphdb.GraphDbClient, emotion *emotionAPI) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -331,33 +767,70 @@ func handleAddReply(client graphdb.GraphDbClient) http.HandlerFunc {
 		postId := strings.TrimPrefix(r.URL.Path, "/posts/")
 		postId = strings.TrimSuffix(postId, "/replies")
 
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
 		var req ReplyRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" || req.Content == "" {
-			http.Error(w, "Missing userId or content", http.StatusBadRequest)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		logger := loggerFrom(r.Context())
 
-		postConstent, err := client.GetPostContent(postId)
+		// Check the user may reply before spending an analysis call on it
+		viewer := graphdb.Viewer{ID: req.UserID}
+		postContent, err := client.GetPostContent(postId, viewer)
 		if err != nil {
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+				return
+			}
+			logger.Error("failed to get post content", "post_id", postId, "err", err)
 			http.Error(w, "Failed to get post content", http.StatusInternalServerError)
 			return
 		}
-		emotionResp, err := analyzeEmotionOfReply(postConstent, req.Content)
+		var parents []string
+		if req.ParentReplyID != "" {
+			parents, err = client.GetReplyChain(postId, req.ParentReplyID, viewer)
+			if err != nil {
+				if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+					return
+				}
+				logger.Error("failed to get reply chain", "post_id", postId, "reply_id", req.ParentReplyID, "err", err)
+				http.Error(w, "Failed to get post content", http.StatusInternalServerError)
+				return
+			}
+			parents = parents[max(0, len(parents)-replyContextDepth):]
+		}
+		rawEmotions, err := emotion.analyzeEmotionOfReply(r.Context(), postContent, parents, req.Content)
 		if err != nil {
-			http.Error(w, "Emotion analysis failed", http.StatusInternalServerError)
+			logger.Error("emotion analysis failed", "endpoint", "analyze_reply", "post_id", postId, "err", err)
+			writeEmotionError(w, err)
 			return
 		}
+		emotionResp := emotion.selectTags(r.Context(), rawEmotions)
 
-		replyId, err := client.AddReplyWithEmotions(postId, req.UserID, req.Content, emotionResp)
+		replyId, err := client.AddReplyWithEmotions(postId, req.ParentReplyID, req.UserID, req.Content, emotionResp, rawEmotions)
 		if err != nil {
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+				return
+			}
+			logger.Error("failed to add reply", "post_id", postId, "parent_reply_id", req.ParentReplyID, "user_id", req.UserID, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
+		repliesCreated.Inc()
 
 		// Register influence for each emotion
 		for _, emotion := range emotionResp {
 			if err := client.AddInfluence(req.UserID, postId, emotion.Type); err != nil {
-				log.Printf("Failed to register influence: %v", err)
+				logger.Error("failed to register influence", "post_id", postId, "user_id", req.UserID, "err", err)
 			}
 		}
 
@@ -379,9 +852,24 @@ func handleGetReplies(client graphdb.GraphDbClient) http.HandlerFunc {
 
 		postId := strings.TrimPrefix(r.URL.Path, "/posts/")
 		postId = strings.TrimSuffix(postId, "/replies")
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
-		replies, err := client.GetReplies(postId)
+		// Anonymous readers only see replies to public posts
+		viewerId, _ := authenticatedUserID(r)
+		viewer, errs := viewerFrom(r, viewerId)
+		if errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		replies, err := client.GetReplies(postId, viewer)
 		if err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			loggerFrom(r.Context()).Error("failed to get replies", "post_id", postId, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
@@ -398,18 +886,31 @@ func handleUserFeed(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 
-		// `/users/{userId}/feed` から userId を抽出（使わないが確保）
+		// `/users/{userId}/feed`: blocked and muted users are hidden from userId.
+		// The feed shows what userId may see, so only userId may read it.
 		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 		if len(parts) != 3 || parts[0] != "users" || parts[2] != "feed" {
 			http.Error(w, "Invalid path", http.StatusBadRequest)
 			return
 		}
-		// userId := parts[1] // 将来的に使う想定
+		userId := parts[1]
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+		viewer, errs := viewerFrom(r, userId)
+		if errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
 		emotion := r.URL.Query().Get("emotion")
-		posts, err := client.GetFeed(emotion)
+		posts, err := client.GetFeed(viewer, emotion)
 		if err != nil {
-			log.Printf("Failed to get feed: %v", err)
+			loggerFrom(r.Context()).Error("failed to get feed", "user_id", userId, "emotion", emotion, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
@@ -426,17 +927,85 @@ func handleGetAllEmotionTags(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 
-		tags, err := client.GetAllEmotionTags()
+		q := r.URL.Query()
+
+		// Without options keep the plain alphabetical list
+		if len(q) == 0 {
+			tags, err := client.GetAllEmotionTags()
+			if err != nil {
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+
+			resp := EmotionTagsResponse{
+				EmotionTags: tags,
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		v := validation.New()
+		withStats := v.Bool("stats", q.Get("stats"))
+		activeOnly := v.Bool("active", q.Get("active"))
+		windowDays := v.IntRange("window", q.Get("window"), 1, 365, 7)
+		limit := v.IntRange("limit", q.Get("limit"), 1, 100, 0)
+		sortBy := q.Get("sort")
+		if sortBy == "" {
+			sortBy = "type"
+		}
+		_, ok := emotionTagSorts[sortBy]
+		v.Check(ok, "sort", "must be one of type, usage, recent, score, lastUsed, trending")
+		if errs := v.Errors(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		stats, err := client.GetEmotionTagStats(time.Duration(windowDays) * 24 * time.Hour)
 		if err != nil {
+			loggerFrom(r.Context()).Error("failed to get emotion tag stats", "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		resp := EmotionTagsResponse{
-			EmotionTags: tags,
+		if activeOnly {
+			stats = slices.DeleteFunc(stats, func(s graphdb.EmotionTagStats) bool { return s.RecentCount == 0 })
+		}
+		// Ties fall back to alphabetical order so results are stable
+		slices.SortFunc(stats, func(a, b graphdb.EmotionTagStats) int {
+			return cmp.Or(emotionTagSorts[sortBy](a, b), cmp.Compare(a.Type, b.Type))
+		})
+		if limit > 0 && len(stats) > limit {
+			stats = stats[:limit]
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		if !withStats {
+			tags := make([]graphdb.EmotionTagOnly, len(stats))
+			for i, s := range stats {
+				tags[i] = graphdb.EmotionTagOnly{Type: s.Type}
+			}
+			json.NewEncoder(w).Encode(EmotionTagsResponse{EmotionTags: tags})
+			return
+		}
+
+		resp := EmotionTagStatsResponse{
+			EmotionTags: make([]EmotionTagStats, len(stats)),
+			WindowDays:  windowDays,
+		}
+		for i, s := range stats {
+			resp.EmotionTags[i] = EmotionTagStats{
+				Type:         s.Type,
+				UsageCount:   s.UsageCount,
+				AverageScore: s.AverageScore,
+				RecentCount:  s.RecentCount,
+				Trend:        s.RecentCount - s.PreviousCount,
+			}
+			if !s.LastUsedAt.IsZero() {
+				resp.EmotionTags[i].LastUsedAt = s.LastUsedAt.UTC().Format(time.RFC3339)
+			}
+		}
 		json.NewEncoder(w).Encode(resp)
 	}
 }
@@ -455,82 +1024,46 @@ func handleFollowUser(client graphdb.GraphDbClient) http.HandlerFunc {
 		}
 		userId := parts[1]
 
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
 		var req FollowRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TargetUserID == "" {
-			http.Error(w, "Missing targetUserId", http.StatusBadRequest)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
 			return
 		}
 
-		if err := client.FollowUser(userId, req.TargetUserID); err != nil {
-			log.Printf("Failed to follow: %v", err)
+		requested, err := client.FollowUser(userId, req.TargetUserID)
+		if err != nil {
+			if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+				return
+			}
+			loggerFrom(r.Context()).Error("failed to follow", "user_id", userId, "target_user_id", req.TargetUserID, "err", err)
 			http.Error(w, "Failed to follow", http.StatusInternalServerError)
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(FollowResponse{Status: "followed"})
-	}
-}
-
-func analyzeEmotionOfPost(content string) ([]graphdb.EmotionTag, error) {
-	api := os.Getenv("EMOTION_API")
-	body, _ := json.Marshal(map[string]string{"content": content})
-	resp, err := http.Post(api+"/analyze_post", "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var result []graphdb.EmotionTag
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	return result, nil
-}
-
-func analyzeEmotionOfReply(post string, reply string) ([]graphdb.EmotionTag, error) {
-	api := os.Getenv("EMOTION_API")
-	body, _ := json.Marshal(map[string]string{"post": post, "reply": reply})
-	resp, err := http.Post(api+"/analyze_reply", "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var result []graphdb.EmotionTag
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		writeFollowResult(w, requested)
 	}
-
-	return result, nil
 }
 
-func analyzeTopicSimilarity(content1, content2 string) (bool, error) {
-	api := os.Getenv("EMOTION_API")
-	body, _ := json.Marshal(map[string]string{
-		"post1": content1,
-		"post2": content2,
-	})
-
-	resp, err := http.Post(api+"/analyze_topic_similarity", "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		IsSameTopic bool    `json:"is_same_topic"`
-		Confidence  float64 `json:"confidence"`
+// writeFollowResult answers 201 for a follow, or 202 when a private account
+// still has to approve it
+func writeFollowResult(w http.ResponseWriter, requested bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if requested {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(FollowResponse{Status: "requested"})
+		return
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false, err
-	}
-
-	// 確信度が0.7以上の場合に同じトピックと判断（閾値は調整可能）
-	return result.IsSameTopic && result.Confidence >= 0.7, nil
+	followsCreated.Inc()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(FollowResponse{Status: "followed"})
 }
 
 func handleGetPostInfluence(client graphdb.GraphDbClient) http.HandlerFunc {
@@ -542,10 +1075,16 @@ func handleGetPostInfluence(client graphdb.GraphDbClient) http.HandlerFunc {
 
 		postId := strings.TrimPrefix(r.URL.Path, "/posts/")
 		postId = strings.TrimSuffix(postId, "/influence")
+		if errs := validatePathIDs("postId", postId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
-		influence, err := client.GetPostInfluence(postId)
+		// Anonymous readers only see influence through public accounts
+		viewerId, _ := authenticatedUserID(r)
+		influence, err := client.GetPostInfluence(postId, graphdb.Viewer{ID: viewerId})
 		if err != nil {
-			log.Printf("Failed to get post influence: %v", err)
+			loggerFrom(r.Context()).Error("failed to get post influence", "post_id", postId, "err", err)
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
@@ -601,10 +1140,55 @@ func handleGetUser(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 		userId := parts[1]
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
 		userDetails, err := client.GetUserWithDetails(userId)
 		if err != nil {
-			log.Printf("Failed to get user details: %v", err)
+			if writeIfNotFound(w, err) {
+				return
+			}
+			loggerFrom(r.Context()).Error("failed to get user details", "user_id", userId, "err", err)
+			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userDetails)
+	}
+}
+
+// handleGetUserByUsername handles getting a user's profile by username,
+// ignoring case
+func handleGetUserByUsername(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "users" || parts[1] != "by-username" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		username := parts[2]
+
+		user, err := client.GetUserByUsername(username)
+		if err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			loggerFrom(r.Context()).Error("failed to get user by username", "username", username, "err", err)
+			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+			return
+		}
+
+		userDetails, err := client.GetUserWithDetails(user.ID)
+		if err != nil {
+			loggerFrom(r.Context()).Error("failed to get user details", "user_id", user.ID, "err", err)
 			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
 			return
 		}
@@ -628,10 +1212,21 @@ func handleUserPosts(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 		userId := parts[1]
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		viewerId, _ := authenticatedUserID(r)
+		viewer, errs := viewerFrom(r, viewerId)
+		if errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
-		posts, err := client.GetUserPosts(userId)
+		posts, err := client.GetUserPosts(userId, viewer)
 		if err != nil {
-			log.Printf("Failed to get user posts: %v", err)
+			loggerFrom(r.Context()).Error("failed to get user posts", "user_id", userId, "err", err)
 			http.Error(w, "Failed to get user posts", http.StatusInternalServerError)
 			return
 		}
@@ -646,7 +1241,7 @@ func handleUserPosts(client graphdb.GraphDbClient) http.HandlerFunc {
 // Authentication handlers
 
 // handleRegister handles user registration
-func handleRegister(client graphdb.GraphDbClient) http.HandlerFunc {
+func handleRegister(client graphdb.GraphDbClient, accounts *accountFlows) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -659,24 +1254,34 @@ func handleRegister(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 
-		// Validate input
-		if req.Username == "" || req.Email == "" || req.Password == "" {
-			http.Error(w, "Username, email and password are required", http.StatusBadRequest)
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
 			return
 		}
 
 		// Create user in database
 		userId, err := client.CreateUser(req.Username, req.Email, req.Password)
 		if err != nil {
-			if err.Error() == "email already exists" {
+			switch {
+			case errors.Is(err, graphdb.ErrEmailTaken):
 				http.Error(w, "Email already registered", http.StatusConflict)
 				return
+			case errors.Is(err, graphdb.ErrUsernameTaken):
+				http.Error(w, "Username already taken", http.StatusConflict)
+				return
 			}
-			log.Printf("Failed to create user: %v", err)
+			loggerFrom(r.Context()).Error("failed to create user", "err", err)
 			http.Error(w, "Failed to create user", http.StatusInternalServerError)
 			return
 		}
 
+		// The account works without verification unless configured otherwise,
+		// so a failed email shouldn't fail registration
+		user := graphdb.AuthUser{ID: userId, Username: req.Username, Email: req.Email}
+		if err := accounts.sendVerification(r.Context(), client, user); err != nil {
+			loggerFrom(r.Context()).Error("failed to issue verification token", "user_id", userId, "err", err)
+		}
+
 		// Generate JWT token
 		token := "dummy-token-" + userId // Replace with actual JWT token generation
 
@@ -692,8 +1297,9 @@ func handleRegister(client graphdb.GraphDbClient) http.HandlerFunc {
 	}
 }
 
-// handleLogin handles user login
-func handleLogin(client graphdb.GraphDbClient) http.HandlerFunc {
+// handleLogin handles user login. Accounts are temporarily locked after
+// repeated failures when lockout is non-nil.
+func handleLogin(client graphdb.GraphDbClient, lockout *ratelimit.Lockout, accounts *accountFlows) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -706,24 +1312,41 @@ func handleLogin(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 
-		// Validate input
-		if req.Email == "" || req.Password == "" {
-			http.Error(w, "Email and password are required", http.StatusBadRequest)
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
 			return
 		}
 
+		// Lock the account rather than the identifier, so switching between
+		// email and username doesn't reset the failure count
+		login := req.identifier()
+		user, lookupErr := lookupLoginUser(client, login)
+		lockoutKey := strings.ToLower(login)
+		if lookupErr == nil {
+			lockoutKey = user.ID
+		}
+		if lockout != nil {
+			if locked, remaining := lockout.Locked(lockoutKey); locked {
+				writeTooManyRequests(w, remaining)
+				return
+			}
+		}
+
 		// Validate credentials
-		userId, err := client.ValidateUserCredentials(req.Email, req.Password)
+		userId, err := client.ValidateUserCredentials(login, req.Password)
 		if err != nil {
+			if lockout != nil {
+				lockout.Fail(lockoutKey)
+			}
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
+		if lockout != nil {
+			lockout.Reset(lockoutKey)
+		}
 
-		// Get user details
-		user, err := client.GetUserByEmail(req.Email)
-		if err != nil {
-			log.Printf("Failed to get user: %v", err)
-			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+		if accounts.cfg.RequireVerifiedEmail && !user.EmailVerified {
+			http.Error(w, "Email address not verified", http.StatusForbidden)
 			return
 		}
 
@@ -741,6 +1364,15 @@ func handleLogin(client graphdb.GraphDbClient) http.HandlerFunc {
 	}
 }
 
+// lookupLoginUser finds the user a login identifier refers to: an email
+// address if it contains "@", otherwise a username
+func lookupLoginUser(client graphdb.GraphDbClient, login string) (graphdb.AuthUser, error) {
+	if strings.Contains(login, "@") {
+		return client.GetUserByEmail(login)
+	}
+	return client.GetUserByUsername(login)
+}
+
 // handleGetCurrentUser handles getting the current user from the token
 // handleUserFollowers handles getting followers of a user
 func handleUserFollowers(client graphdb.GraphDbClient) http.HandlerFunc {
@@ -756,16 +1388,15 @@ func handleUserFollowers(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 		userId := parts[1]
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
-		// In a real implementation, we would use the userId to get the followers
-		log.Printf("Getting followers for user: %s", userId)
-
-		// For now, we'll return an empty array
-		// In a real implementation, we would get the followers from the database
 		w.Header().Set("Content-Type", "application/json")
 		followers, err := client.GetFollowers(userId)
 		if err != nil {
-			log.Printf("Failed to get followers: %v", err)
+			loggerFrom(r.Context()).Error("failed to get followers", "user_id", userId, "err", err)
 			http.Error(w, "Failed to get followers", http.StatusInternalServerError)
 			return
 		}
@@ -790,13 +1421,14 @@ func handleUserFollowing(client graphdb.GraphDbClient) http.HandlerFunc {
 				return
 			}
 			userId := parts[1]
-
-			// In a real implementation, we would use the userId to get the following users
-			log.Printf("Getting following users for user: %s", userId)
+			if errs := validatePathIDs("userId", userId); errs != nil {
+				writeValidationErrors(w, errs)
+				return
+			}
 
 			following, err := client.GetFollowing(userId)
 			if err != nil {
-				log.Printf("Failed to get following users: %v", err)
+				loggerFrom(r.Context()).Error("failed to get following users", "user_id", userId, "err", err)
 				http.Error(w, "Failed to get following users", http.StatusInternalServerError)
 				return
 			}
@@ -816,21 +1448,31 @@ func handleUserFollowing(client graphdb.GraphDbClient) http.HandlerFunc {
 			}
 			userId := parts[1]
 
+			if errs := validatePathIDs("userId", userId); errs != nil {
+				writeValidationErrors(w, errs)
+				return
+			}
+
 			var req FollowRequest
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TargetUserID == "" {
-				http.Error(w, "Missing targetUserId", http.StatusBadRequest)
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if errs := req.Validate(); errs != nil {
+				writeValidationErrors(w, errs)
 				return
 			}
 
-			if err := client.FollowUser(userId, req.TargetUserID); err != nil {
-				log.Printf("Failed to follow: %v", err)
+			requested, err := client.FollowUser(userId, req.TargetUserID)
+			if err != nil {
+				if writeIfNotFound(w, err) || writeIfBlocked(w, err) {
+					return
+				}
+				loggerFrom(r.Context()).Error("failed to follow", "user_id", userId, "target_user_id", req.TargetUserID, "err", err)
 				http.Error(w, "Failed to follow", http.StatusInternalServerError)
 				return
 			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusCreated)
-			json.NewEncoder(w).Encode(FollowResponse{Status: "followed"})
+			writeFollowResult(w, requested)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
@@ -852,9 +1494,13 @@ func handleUnfollowUser(client graphdb.GraphDbClient) http.HandlerFunc {
 		}
 		userId := parts[1]
 		targetUserId := parts[3]
+		if errs := validatePathIDs("userId", userId, "targetUserId", targetUserId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
 
 		if err := client.UnfollowUser(userId, targetUserId); err != nil {
-			log.Printf("Failed to unfollow: %v", err)
+			loggerFrom(r.Context()).Error("failed to unfollow", "user_id", userId, "target_user_id", targetUserId, "err", err)
 			http.Error(w, "Failed to unfollow", http.StatusInternalServerError)
 			return
 		}
@@ -871,33 +1517,15 @@ func handleGetCurrentUser(client graphdb.GraphDbClient) http.HandlerFunc {
 			return
 		}
 
-		// Get token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract token from "Bearer <token>"
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
-			return
-		}
-		tokenString := tokenParts[1]
-
-		// In a real implementation, we would validate the JWT token
-		// For now, we'll extract the user ID from our dummy token
-		if !strings.HasPrefix(tokenString, "dummy-token-") {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		userId, err := authenticatedUserID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		userId := strings.TrimPrefix(tokenString, "dummy-token-")
 
-		// Get user by ID
-		user, err := client.GetUserById(userId)
+		user, err := client.GetUserWithDetails(userId)
 		if err != nil {
-			log.Printf("Failed to get user: %v", err)
+			loggerFrom(r.Context()).Error("failed to get user", "user_id", userId, "err", err)
 			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
 			return
 		}
@@ -907,11 +1535,11 @@ func handleGetCurrentUser(client graphdb.GraphDbClient) http.HandlerFunc {
 			"id":             user.ID,
 			"username":       user.Username,
 			"email":          user.Email,
-			"displayName":    user.Username,                                       // Use username as displayName for now
-			"avatarUrl":      "https://ui-avatars.com/api/?name=" + user.Username, // Generate avatar from username
-			"bio":            "",                                                  // Empty bio for now
-			"followersCount": 0,                                                   // Default value
-			"followingCount": 0,                                                   // Default value
+			"displayName":    user.DisplayName,
+			"avatarUrl":      user.AvatarUrl,
+			"bio":            user.Bio,
+			"followersCount": user.FollowersCount,
+			"followingCount": user.FollowingCount,
 			"emotionalProfile": map[string]interface{}{
 				"dominantEmotions": []string{"neutral"}, // Default emotion
 				"emotionalRange":   50,                  // Middle of the range (0-100)
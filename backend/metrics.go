@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of API requests by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	neo4jQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "neo4j_query_duration_seconds",
+		Help:    "Latency of GraphDbClient calls by method and outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+
+	emotionRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "emotion_request_duration_seconds",
+		Help: "Latency of calls to the emotion analysis service by endpoint.",
+		// LLM calls routinely take several seconds
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+	}, []string{"endpoint"})
+
+	emotionRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "emotion_request_errors_total",
+		Help: "Failed calls to the emotion analysis service by endpoint.",
+	}, []string{"endpoint"})
+
+	emotionBreakerOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "emotion_circuit_open",
+		Help: "1 while the emotion service circuit breaker is open or half-open.",
+	})
+
+	emotionCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "emotion_cache_lookups_total",
+		Help: "Emotion analysis cache lookups by endpoint and result (memory_hit, store_hit, miss).",
+	}, []string{"endpoint", "result"})
+
+	postsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "posts_created_total",
+		Help: "Posts created.",
+	})
+
+	repliesCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "replies_created_total",
+		Help: "Replies created.",
+	})
+
+	reactionsAdded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reactions_added_total",
+		Help: "Reactions added by reaction type.",
+	}, []string{"type"})
+
+	emotionCorrections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "emotion_corrections_total",
+		Help: "Emotion tag corrections made by post authors.",
+	})
+
+	followsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "follows_created_total",
+		Help: "Follow relationships created.",
+	})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Requests rejected with 429 by rate limit class.",
+	}, []string{"class"})
+)
+
+// observeNeo4jQuery is the graphdb.QueryObserver feeding neo4jQueryDuration
+func observeNeo4jQuery(method string, d time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	neo4jQueryDuration.WithLabelValues(method, outcome).Observe(d.Seconds())
+}
+
+// observeEmotionRequest records one attempt to call the emotion analysis service
+func observeEmotionRequest(endpoint string, d time.Duration, err error) {
+	emotionRequestDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+	if err != nil {
+		emotionRequestErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// observeEmotionBreaker tracks the emotion client's circuit breaker state
+func observeEmotionBreaker(state string) {
+	if state == "closed" {
+		emotionBreakerOpen.Set(0)
+	} else {
+		emotionBreakerOpen.Set(1)
+	}
+}
+
+// withMetrics records request latency labelled by route template
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		httpRequestDuration.
+			WithLabelValues(routeLabel(r.URL.Path), r.Method, strconv.Itoa(sw.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// staticRoutes are paths without IDs that are reported as-is
+var staticRoutes = map[string]bool{
+	"/posts":                       true,
+	"/auth/register":               true,
+	"/auth/login":                  true,
+	"/auth/me":                     true,
+	"/auth/verify-email":           true,
+	"/auth/verify-email/resend":    true,
+	"/auth/password/change":        true,
+	"/auth/password/reset/request": true,
+	"/auth/password/reset":         true,
+	"/emotion-tags":                true,
+	"/search":                      true,
+	"/users":                       true,
+
+	"/admin/emotions/merge":      true,
+	"/admin/emotion-corrections": true,
+	"/admin/phantom-users":       true,
+}
+
+// routeSubresources lists the known sub-paths under /posts/{postId} and
+// /users/{userId}; anything else is reported as "other".
+var routeSubresources = map[string]map[string]bool{
+	"posts": {"replies": true, "reactions": true, "influence": true, "emotions": true, "reposts": true},
+	"users": {
+		"feed": true, "follow": true, "posts": true, "followers": true, "following": true,
+		"suggestions": true, "avatar": true, "blocks": true, "mutes": true, "emotion-filters": true,
+		"follow-requests": true,
+	},
+}
+
+// routeLabel turns a request path into its route template so IDs don't
+// blow up label cardinality, e.g. /posts/abc/replies -> /posts/{postId}/replies
+func routeLabel(path string) string {
+	if staticRoutes[path] {
+		return path
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return "other"
+	}
+	switch parts[0] {
+	case "posts":
+		parts[1] = "{postId}"
+	case "users":
+		if len(parts) == 3 && parts[1] == "by-username" {
+			return "/users/by-username/{username}"
+		}
+		parts[1] = "{userId}"
+	default:
+		return "other"
+	}
+
+	switch {
+	case len(parts) == 2:
+	case len(parts) == 3 && routeSubresources[parts[0]][parts[2]]:
+	case len(parts) == 4 && parts[0] == "users" && (parts[2] == "following" || parts[2] == "blocks" || parts[2] == "mutes"):
+		parts[3] = "{targetUserId}"
+	case len(parts) == 5 && parts[0] == "posts" && parts[2] == "replies" && parts[4] == "reactions":
+		parts[3] = "{replyId}"
+	case len(parts) == 4 && parts[0] == "users" && parts[2] == "emotion-filters":
+		parts[3] = "{emotion}"
+	case len(parts) == 5 && parts[0] == "users" && parts[2] == "follow-requests" && (parts[4] == "approve" || parts[4] == "deny"):
+		parts[3] = "{requesterId}"
+	default:
+		return "other"
+	}
+	return "/" + strings.Join(parts, "/")
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/avatar"
+	"github.com/HarutoKitagawa/emotional_sns/backend/blob"
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+	"github.com/google/uuid"
+)
+
+// avatarField is the multipart form field carrying the image
+const avatarField = "avatar"
+
+type ProfileUpdateRequest struct {
+	DisplayName *string `json:"displayName"`
+	Bio         *string `json:"bio"`
+	Private     *bool   `json:"private"`
+}
+
+func (r ProfileUpdateRequest) Validate() validation.Errors {
+	v := validation.New()
+	if r.DisplayName != nil {
+		v.Length("displayName", *r.DisplayName, 1, validation.MaxDisplayNameLength)
+	}
+	if r.Bio != nil {
+		v.Length("bio", *r.Bio, 0, validation.MaxBioLength)
+	}
+	return v.Errors()
+}
+
+type AvatarResponse struct {
+	AvatarUrl string `json:"avatarUrl"`
+}
+
+// avatarUploads processes uploaded avatars and keeps them in a blob store
+type avatarUploads struct {
+	store    blob.Store
+	maxBytes int64
+	size     int
+}
+
+func newAvatarUploads(store blob.Store, cfg config.Avatar) *avatarUploads {
+	return &avatarUploads{store: store, maxBytes: cfg.MaxBytes, size: cfg.Size}
+}
+
+// authorizeSelf lets a request through only when the caller is userId,
+// answering 401 or 403 otherwise
+func authorizeSelf(w http.ResponseWriter, r *http.Request, userId string) bool {
+	callerId, err := authenticatedUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	if callerId != userId {
+		http.Error(w, "You can only change your own account", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleUpdateProfile changes the caller's display name, bio and whether
+// their account is private
+func handleUpdateProfile(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] != "users" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+
+		var req ProfileUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if errs := req.Validate(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if req.DisplayName != nil {
+			trimmed := strings.TrimSpace(*req.DisplayName)
+			req.DisplayName = &trimmed
+		}
+
+		logger := loggerFrom(r.Context())
+		if err := client.UpdateUserProfile(userId, graphdb.ProfileUpdate{DisplayName: req.DisplayName, Bio: req.Bio, Private: req.Private}); err != nil {
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to update profile", "user_id", userId, "err", err)
+			http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+			return
+		}
+
+		userDetails, err := client.GetUserWithDetails(userId)
+		if err != nil {
+			logger.Error("failed to get user details", "user_id", userId, "err", err)
+			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userDetails)
+	}
+}
+
+// handleAvatar replaces (PUT, multipart/form-data) or removes (DELETE) the
+// caller's avatar. Removed and replaced images are deleted from the store.
+func handleAvatar(client graphdb.GraphDbClient, avatars *avatarUploads) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 || parts[0] != "users" || parts[2] != "avatar" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		userId := parts[1]
+		if errs := validatePathIDs("userId", userId); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+		if !authorizeSelf(w, r, userId) {
+			return
+		}
+
+		logger := loggerFrom(r.Context())
+
+		if r.Method == http.MethodDelete {
+			previousKey, err := client.SetUserAvatar(userId, "", "")
+			if err != nil {
+				if writeIfNotFound(w, err) {
+					return
+				}
+				logger.Error("failed to remove avatar", "user_id", userId, "err", err)
+				http.Error(w, "Failed to remove avatar", http.StatusInternalServerError)
+				return
+			}
+			avatars.delete(r.Context(), previousKey)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		data, err := avatars.read(w, r)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr), errors.Is(err, errAvatarTooLarge):
+				http.Error(w, "Avatar is too large", http.StatusRequestEntityTooLarge)
+			case errors.Is(err, http.ErrMissingFile):
+				writeValidationErrors(w, validation.Errors{{Field: avatarField, Message: "is required"}})
+			default:
+				http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+			}
+			return
+		}
+
+		image, err := avatar.Process(data, avatars.size)
+		if err != nil {
+			writeValidationErrors(w, validation.Errors{{Field: avatarField, Message: err.Error()}})
+			return
+		}
+
+		// A fresh key per upload lets clients and CDNs cache avatars forever
+		key := "avatars/" + userId + "/" + uuid.New().String() + ".jpg"
+		avatarUrl, err := avatars.store.Put(r.Context(), key, avatar.ContentType, image)
+		if err != nil {
+			logger.Error("failed to store avatar", "user_id", userId, "err", err)
+			http.Error(w, "Failed to store avatar", http.StatusInternalServerError)
+			return
+		}
+
+		previousKey, err := client.SetUserAvatar(userId, key, avatarUrl)
+		if err != nil {
+			avatars.delete(r.Context(), key)
+			if writeIfNotFound(w, err) {
+				return
+			}
+			logger.Error("failed to set avatar", "user_id", userId, "err", err)
+			http.Error(w, "Failed to set avatar", http.StatusInternalServerError)
+			return
+		}
+		avatars.delete(r.Context(), previousKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AvatarResponse{AvatarUrl: avatarUrl})
+	}
+}
+
+var errAvatarTooLarge = errors.New("avatar too large")
+
+// read returns the contents of the avatar field of a multipart body,
+// streaming it instead of spooling the form to disk
+func (a *avatarUploads) read(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	// Leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, a.maxBytes+64<<10)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != avatarField {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, a.maxBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > a.maxBytes {
+			return nil, errAvatarTooLarge
+		}
+		return data, nil
+	}
+}
+
+// delete removes a replaced avatar; failures only leave an orphaned file
+func (a *avatarUploads) delete(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := a.store.Delete(ctx, key); err != nil {
+		loggerFrom(ctx).Warn("failed to delete avatar", "key", key, "err", err)
+	}
+}
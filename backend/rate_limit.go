@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/config"
+	"github.com/HarutoKitagawa/emotional_sns/backend/ratelimit"
+)
+
+// Rate limit classes. Analysis writes are the expensive ones since each
+// triggers one or more LLM calls in the emotion analysis service.
+const (
+	limitAnalysis = "analysis"
+	limitWrites   = "writes"
+	limitLogin    = "login"
+)
+
+// rateLimits holds one limiter per class, each keyed by client IP and, for
+// authenticated requests, by user ID as well.
+type rateLimits struct {
+	limiters          map[string]*ratelimit.Limiter
+	trustForwardedFor bool
+}
+
+func newRateLimits(cfg config.RateLimit) *rateLimits {
+	newLimiter := func(r config.Rate) *ratelimit.Limiter {
+		return ratelimit.New(r.Requests, r.Per, r.Burst)
+	}
+	return &rateLimits{
+		limiters: map[string]*ratelimit.Limiter{
+			limitAnalysis: newLimiter(cfg.Analysis),
+			limitWrites:   newLimiter(cfg.Writes),
+			limitLogin:    newLimiter(cfg.Login),
+		},
+		trustForwardedFor: cfg.TrustForwardedFor,
+	}
+}
+
+// rateLimitClass returns the limiter class for a request, or "" if it is not
+// rate limited
+func rateLimitClass(method, route string) string {
+	switch method + " " + route {
+	case "POST /posts", "POST /posts/{postId}/replies":
+		return limitAnalysis
+	case "POST /posts/{postId}/reactions",
+		"POST /posts/{postId}/replies/{replyId}/reactions",
+		"POST /posts/{postId}/reposts",
+		"PUT /posts/{postId}/emotions",
+		"PATCH /users/{userId}",
+		"DELETE /users/{userId}",
+		"PUT /users/{userId}/avatar",
+		"DELETE /users/{userId}/avatar",
+		"POST /users/{userId}/follow",
+		"POST /users/{userId}/following",
+		"DELETE /users/{userId}/following/{targetUserId}",
+		"POST /users/{userId}/blocks",
+		"DELETE /users/{userId}/blocks/{targetUserId}",
+		"POST /users/{userId}/mutes",
+		"DELETE /users/{userId}/mutes/{targetUserId}",
+		"PUT /users/{userId}/emotion-filters/{emotion}",
+		"DELETE /users/{userId}/emotion-filters/{emotion}",
+		"POST /users/{userId}/follow-requests/{requesterId}/approve",
+		"POST /users/{userId}/follow-requests/{requesterId}/deny",
+		"POST /auth/register",
+		"POST /auth/verify-email":
+		return limitWrites
+	case "POST /auth/login",
+		"POST /auth/verify-email/resend",
+		"POST /auth/password/change",
+		"POST /auth/password/reset/request",
+		"POST /auth/password/reset":
+		return limitLogin
+	}
+	return ""
+}
+
+// middleware rejects requests over their class's limit with 429 and a
+// Retry-After header
+func (l *rateLimits) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := rateLimitClass(r.Method, routeLabel(r.URL.Path))
+		if class == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limiter := l.limiters[class]
+
+		keys := []string{"ip:" + l.clientIP(r)}
+		if userId, err := authenticatedUserID(r); err == nil {
+			keys = append(keys, "user:"+userId)
+		}
+		for _, key := range keys {
+			if ok, retryAfter := limiter.Allow(key); !ok {
+				rateLimited.WithLabelValues(class).Inc()
+				loggerFrom(r.Context()).Warn("rate limited", "class", class, "key", key)
+				writeTooManyRequests(w, retryAfter)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address requests are limited by
+func (l *rateLimits) clientIP(r *http.Request) string {
+	if l.trustForwardedFor {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeTooManyRequests answers 429 telling the client when to retry
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,164 @@
+// Package ratelimit provides in-memory token buckets keyed by client and a
+// lockout tracker for repeated login failures.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// idleTTL is how long an untouched bucket is kept before it is swept
+const idleTTL = 10 * time.Minute
+
+// Limiter holds one token bucket per key. Each bucket refills at rate tokens
+// per second up to burst.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing requests per interval per key, with bursts of
+// up to burst requests. A burst below 1 defaults to requests.
+func New(requests int, per time.Duration, burst int) *Limiter {
+	if burst < 1 {
+		burst = requests
+	}
+	return &Limiter{
+		rate:    float64(requests) / per.Seconds(),
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow takes one token from key's bucket. When the bucket is empty it
+// returns false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Lockout locks a key (e.g. an account) after too many failures within a
+// window, for a fixed duration.
+type Lockout struct {
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+	now     func() time.Time
+}
+
+type lockoutEntry struct {
+	failures    int
+	firstFail   time.Time
+	lockedUntil time.Time
+}
+
+func NewLockout(threshold int, window, duration time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		window:    window,
+		duration:  duration,
+		entries:   map[string]*lockoutEntry{},
+		now:       time.Now,
+	}
+}
+
+// Locked reports whether key is locked and for how much longer
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return false, 0
+	}
+	if remaining := e.lockedUntil.Sub(l.now()); remaining > 0 {
+		return true, remaining
+	}
+	return false, 0
+}
+
+// Fail records a failure for key and locks it once the threshold is reached
+func (l *Lockout) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.firstFail) > l.window {
+		e = &lockoutEntry{firstFail: now}
+		l.entries[key] = e
+	}
+	e.failures++
+	if e.failures >= l.threshold {
+		e.lockedUntil = now.Add(l.duration)
+		e.failures = 0
+		e.firstFail = now
+	}
+}
+
+// sweep forgets entries that are neither locked nor inside their window
+func (l *Lockout) sweep(now time.Time) {
+	if len(l.entries) < 1024 {
+		return
+	}
+	for key, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.firstFail) > l.window {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Reset clears key's failures, e.g. after a successful login
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
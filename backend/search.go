@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+	"github.com/HarutoKitagawa/emotional_sns/backend/taxonomy"
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+const (
+	maxSearchQueryLength = 100
+	snippetLength        = 120 // runes
+)
+
+type SearchHit struct {
+	Type        string               `json:"type"` // post or reply
+	ID          string               `json:"id"`
+	PostID      string               `json:"postId"`
+	UserID      string               `json:"userId"`
+	CreatedAt   string               `json:"createdAt"`
+	Score       float64              `json:"score"`
+	Snippet     string               `json:"snippet"`
+	Highlights  [][2]int             `json:"highlights"` // [start, end) rune offsets into snippet
+	EmotionTags []graphdb.EmotionTag `json:"emotionTags"`
+}
+
+type SearchResponse struct {
+	Total  int            `json:"total"`
+	Hits   []SearchHit    `json:"hits"`
+	Facets map[string]int `json:"facets"`
+}
+
+// handleSearch runs a full-text search over posts and replies
+func handleSearch(client graphdb.GraphDbClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		v := validation.New()
+		text := q.Get("q")
+		v.Required("q", text)
+		v.Length("q", text, 1, maxSearchQueryLength)
+		if author := q.Get("author"); author != "" {
+			v.UUID("author", author)
+		}
+		emotion := q.Get("emotion")
+		if emotion != "" {
+			canonical, ok := taxonomy.Canonicalize(emotion)
+			v.Check(ok, "emotion", "must be a known emotion")
+			emotion = canonical
+		}
+		from := searchTime(v, "from", q.Get("from"))
+		to := searchTime(v, "to", q.Get("to"))
+		limit := v.IntRange("limit", q.Get("limit"), 1, 50, 20)
+		offset := v.IntRange("offset", q.Get("offset"), 0, 1000, 0)
+		if errs := v.Errors(); errs != nil {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		terms := strings.Fields(text)
+		viewerId, _ := authenticatedUserID(r)
+		result, err := client.Search(graphdb.SearchQuery{
+			Text:     luceneQuery(terms),
+			Emotion:  emotion,
+			AuthorID: q.Get("author"),
+			From:     from,
+			To:       to,
+			Limit:    limit,
+			Offset:   offset,
+			ViewerID: viewerId,
+		})
+		if err != nil {
+			loggerFrom(r.Context()).Error("search failed", "err", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := SearchResponse{
+			Total:  result.Total,
+			Hits:   make([]SearchHit, len(result.Hits)),
+			Facets: result.Facets,
+		}
+		for i, hit := range result.Hits {
+			snippet, highlights := highlightSnippet(hit.Content, terms)
+			resp.Hits[i] = SearchHit{
+				Type:        hit.Kind,
+				ID:          hit.ID,
+				PostID:      hit.PostID,
+				UserID:      hit.UserID,
+				CreatedAt:   hit.CreatedAt,
+				Score:       hit.Score,
+				Snippet:     snippet,
+				Highlights:  highlights,
+				EmotionTags: hit.EmotionTags,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// searchTime validates an RFC 3339 filter and normalizes it to the UTC
+// format createdAt is stored in, so the two compare as strings
+func searchTime(v *validation.Validator, field, value string) string {
+	if value == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	v.Check(err == nil, field, "must be an RFC 3339 timestamp")
+	return t.UTC().Format(time.RFC3339)
+}
+
+// luceneQuery matches content containing every term. Terms are escaped so
+// user input can't inject Lucene syntax; the CJK analyzer splits Japanese
+// terms into bigrams, so quoting keeps their characters adjacent.
+func luceneQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + luceneEscape(term) + `"`
+	}
+	return strings.Join(quoted, " AND ")
+}
+
+// luceneSpecial escapes every character with a meaning in Lucene query syntax
+var luceneSpecial = strings.NewReplacer(
+	`\`, `\\`, `+`, `\+`, `-`, `\-`, `&`, `\&`, `|`, `\|`, `!`, `\!`,
+	`(`, `\(`, `)`, `\)`, `{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`,
+	`^`, `\^`, `"`, `\"`, `~`, `\~`, `*`, `\*`, `?`, `\?`, `:`, `\:`, `/`, `\/`,
+)
+
+func luceneEscape(term string) string {
+	return luceneSpecial.Replace(term)
+}
+
+// highlightSnippet cuts a window of content around the first matching term
+// and returns it with the rune ranges of every term occurrence
+func highlightSnippet(content string, terms []string) (string, [][2]int) {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length; match against the original
+		lower = runes
+	}
+
+	// Start a little before the first match so it has some context
+	start := 0
+	if first := firstMatch(lower, terms); first > snippetLength/4 {
+		start = first - snippetLength/4
+	}
+	end := min(start+snippetLength, len(runes))
+	window := lower[start:end]
+
+	highlights := [][2]int{}
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(window); i++ {
+			if string(window[i:i+len(t)]) == string(t) {
+				highlights = append(highlights, [2]int{i, i + len(t)})
+				i += len(t) - 1
+			}
+		}
+	}
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+		for i := range highlights {
+			highlights[i][0]++
+			highlights[i][1]++
+		}
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet, highlights
+}
+
+// firstMatch returns the rune offset of the earliest term occurrence, or -1
+func firstMatch(content []rune, terms []string) int {
+	first := -1
+	s := string(content)
+	for _, term := range terms {
+		if i := strings.Index(s, strings.ToLower(term)); i >= 0 {
+			if offset := utf8.RuneCountInString(s[:i]); first < 0 || offset < first {
+				first = offset
+			}
+		}
+	}
+	return first
+}
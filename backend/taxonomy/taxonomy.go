@@ -0,0 +1,144 @@
+// Package taxonomy defines the canonical emotion vocabulary, based on
+// Plutchik's wheel: eight primary emotions, each in a mild, basic and intense
+// form. Free-form words from the analyzer are mapped onto it.
+package taxonomy
+
+import (
+	"strings"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/graphdb"
+)
+
+type Intensity int
+
+const (
+	Mild Intensity = iota + 1
+	Basic
+	Intense
+)
+
+// Emotion is one canonical emotion. Primary is the basic emotion it is a
+// form of; for the primaries themselves Primary equals Name.
+type Emotion struct {
+	Name      string
+	Primary   string
+	Intensity Intensity
+}
+
+// Emotions lists the canonical vocabulary, grouped by primary emotion
+var Emotions = []Emotion{
+	{"serenity", "joy", Mild}, {"joy", "joy", Basic}, {"ecstasy", "joy", Intense},
+	{"acceptance", "trust", Mild}, {"trust", "trust", Basic}, {"admiration", "trust", Intense},
+	{"apprehension", "fear", Mild}, {"fear", "fear", Basic}, {"terror", "fear", Intense},
+	{"distraction", "surprise", Mild}, {"surprise", "surprise", Basic}, {"amazement", "surprise", Intense},
+	{"pensiveness", "sadness", Mild}, {"sadness", "sadness", Basic}, {"grief", "sadness", Intense},
+	{"boredom", "disgust", Mild}, {"disgust", "disgust", Basic}, {"loathing", "disgust", Intense},
+	{"annoyance", "anger", Mild}, {"anger", "anger", Basic}, {"rage", "anger", Intense},
+	{"interest", "anticipation", Mild}, {"anticipation", "anticipation", Basic}, {"vigilance", "anticipation", Intense},
+}
+
+// synonyms maps words the analyzer commonly returns to canonical emotions
+var synonyms = map[string]string{
+	// joy
+	"happiness": "joy", "happy": "joy", "delight": "joy", "gladness": "joy", "glad": "joy",
+	"cheerfulness": "joy", "pleasure": "joy", "amusement": "joy", "fun": "joy", "love": "joy",
+	"affection": "joy", "pride": "joy", "satisfaction": "joy",
+	"contentment": "serenity", "calm": "serenity", "calmness": "serenity", "peace": "serenity",
+	"relief": "serenity", "relaxation": "serenity", "comfort": "serenity",
+	"elation": "ecstasy", "euphoria": "ecstasy", "bliss": "ecstasy", "excitement": "ecstasy",
+	// trust
+	"confidence": "trust", "faith": "trust", "gratitude": "trust", "thankfulness": "trust",
+	"empathy": "trust", "sympathy": "trust", "compassion": "trust",
+	"approval": "acceptance", "agreement": "acceptance", "tolerance": "acceptance",
+	"respect": "admiration", "awe": "admiration", "reverence": "admiration",
+	// fear
+	"anxiety": "apprehension", "worry": "apprehension", "nervousness": "apprehension",
+	"unease": "apprehension", "concern": "apprehension", "insecurity": "apprehension",
+	"scared": "fear", "afraid": "fear", "fright": "fear",
+	"panic": "terror", "horror": "terror", "dread": "terror",
+	// surprise
+	"confusion": "distraction", "uncertainty": "distraction", "puzzlement": "distraction",
+	"surprised": "surprise", "unexpectedness": "surprise",
+	"astonishment": "amazement", "shock": "amazement", "wonder": "amazement",
+	// sadness
+	"nostalgia": "pensiveness", "wistfulness": "pensiveness", "melancholy": "pensiveness",
+	"sad": "sadness", "sorrow": "sadness", "unhappiness": "sadness", "disappointment": "sadness",
+	"loneliness": "sadness", "regret": "sadness", "guilt": "sadness", "shame": "sadness",
+	"despair": "grief", "heartbreak": "grief", "mourning": "grief", "anguish": "grief",
+	// disgust
+	"indifference": "boredom", "bored": "boredom", "tiredness": "boredom", "fatigue": "boredom",
+	"disgusted": "disgust", "revulsion": "disgust", "distaste": "disgust", "contempt": "disgust",
+	"disapproval": "disgust",
+	"hate":        "loathing", "hatred": "loathing", "abhorrence": "loathing",
+	// anger
+	"irritation": "annoyance", "annoyed": "annoyance", "impatience": "annoyance",
+	"frustration": "annoyance",
+	"angry":       "anger", "mad": "anger", "resentment": "anger", "indignation": "anger",
+	"jealousy": "anger", "envy": "anger",
+	"fury": "rage", "outrage": "rage", "wrath": "rage",
+	// anticipation
+	"curiosity": "interest", "interested": "interest", "intrigue": "interest",
+	"expectation": "anticipation", "hope": "anticipation", "hopefulness": "anticipation",
+	"eagerness": "anticipation", "optimism": "anticipation", "determination": "anticipation",
+	"motivation": "anticipation",
+	"alertness":  "vigilance", "vigilant": "vigilance", "tension": "vigilance",
+}
+
+var byName = func() map[string]Emotion {
+	m := make(map[string]Emotion, len(Emotions))
+	for _, e := range Emotions {
+		m[e.Name] = e
+	}
+	return m
+}()
+
+// Lookup returns the canonical emotion for a canonical name
+func Lookup(name string) (Emotion, bool) {
+	e, ok := byName[name]
+	return e, ok
+}
+
+// Canonicalize maps a free-form emotion word to its canonical name
+func Canonicalize(word string) (string, bool) {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if _, ok := byName[word]; ok {
+		return word, true
+	}
+	if name, ok := synonyms[word]; ok {
+		return name, true
+	}
+	return "", false
+}
+
+// Normalize maps tags onto the canonical vocabulary. Tags mapping to the same
+// emotion are merged keeping the highest score; words outside the vocabulary
+// are dropped and returned separately. Order of first appearance is kept.
+func Normalize(tags []graphdb.EmotionTag) (normalized []graphdb.EmotionTag, unknown []string) {
+	index := map[string]int{}
+	for _, tag := range tags {
+		name, ok := Canonicalize(tag.Type)
+		if !ok {
+			unknown = append(unknown, tag.Type)
+			continue
+		}
+		if i, seen := index[name]; seen {
+			normalized[i].Score = max(normalized[i].Score, tag.Score)
+			continue
+		}
+		index[name] = len(normalized)
+		normalized = append(normalized, graphdb.EmotionTag{Type: name, Score: tag.Score})
+	}
+	return normalized, unknown
+}
+
+// Definitions describes the taxonomy as Emotion nodes and PARENT relations
+func Definitions() []graphdb.EmotionDefinition {
+	defs := make([]graphdb.EmotionDefinition, len(Emotions))
+	for i, e := range Emotions {
+		defs[i] = graphdb.EmotionDefinition{Type: e.Name, Intensity: int(e.Intensity)}
+		if e.Name != e.Primary {
+			defs[i].Parent = e.Primary
+		}
+	}
+	return defs
+}
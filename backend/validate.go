@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/HarutoKitagawa/emotional_sns/backend/validation"
+)
+
+type ValidationErrorResponse struct {
+	Errors validation.Errors `json:"errors"`
+}
+
+// writeValidationErrors responds with 422 and the list of rejected fields
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(ValidationErrorResponse{Errors: errs})
+}
+
+// validatePathIDs checks that every named path parameter is a UUID
+func validatePathIDs(params ...string) validation.Errors {
+	v := validation.New()
+	for i := 0; i+1 < len(params); i += 2 {
+		v.UUID(params[i], params[i+1])
+	}
+	return v.Errors()
+}
+
+func (r PostRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("userId", r.UserID)
+	v.UUID("userId", r.UserID)
+	v.Required("content", r.Content)
+	v.Length("content", r.Content, 1, validation.MaxPostLength)
+	if r.Visibility != "" {
+		v.PostVisibility("visibility", r.Visibility)
+	}
+	if r.QuotedPostID != "" {
+		v.UUID("quotedPostId", r.QuotedPostID)
+	}
+	return v.Errors()
+}
+
+func (r ReplyRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("userId", r.UserID)
+	v.UUID("userId", r.UserID)
+	v.Required("content", r.Content)
+	v.Length("content", r.Content, 1, validation.MaxReplyLength)
+	if r.ParentReplyID != "" {
+		v.UUID("parentReplyId", r.ParentReplyID)
+	}
+	return v.Errors()
+}
+
+func (r ReactionRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("userId", r.UserID)
+	v.UUID("userId", r.UserID)
+	v.Required("type", r.Type)
+	v.ReactionType("type", r.Type)
+	return v.Errors()
+}
+
+func (r RepostRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("userId", r.UserID)
+	v.UUID("userId", r.UserID)
+	return v.Errors()
+}
+
+func (r FollowRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("targetUserId", r.TargetUserID)
+	v.UUID("targetUserId", r.TargetUserID)
+	return v.Errors()
+}
+
+func (r RegisterRequest) Validate() validation.Errors {
+	v := validation.New()
+	v.Required("username", r.Username)
+	v.Username("username", r.Username)
+	v.Required("email", r.Email)
+	v.Email("email", r.Email)
+	v.Required("password", r.Password)
+	v.Password("password", r.Password)
+	return v.Errors()
+}
+
+func (r LoginRequest) Validate() validation.Errors {
+	v := validation.New()
+	if r.Login == "" && r.Email != "" {
+		v.Email("email", r.Email)
+	} else {
+		v.Required("login", r.Login)
+	}
+	v.Required("password", r.Password)
+	return v.Errors()
+}
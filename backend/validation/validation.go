@@ -0,0 +1,180 @@
+// Package validation collects field-level errors for API request bodies and
+// path parameters.
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxPostLength     = 1000
+	MaxReplyLength    = 500
+	MinPasswordLength = 8
+	MaxPasswordLength = 72 // bcrypt ignores anything past 72 bytes
+
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 160
+
+	// MaxEmotionTags limits how many tags an author may set on a post
+	MaxEmotionTags = 10
+)
+
+// ReactionTypes lists the reactions a user can leave on a post.
+var ReactionTypes = []string{"like", "love", "cry", "angry", "wow"}
+
+// PostVisibilities lists who a post can be shown to: everyone, the author's
+// followers, or only the author.
+var PostVisibilities = []string{"public", "followers", "private"}
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedUsernames can't be registered: they would impersonate staff or
+// clash with paths that profile URLs share (/users/{id}/posts, /settings, ...).
+// Compared case-insensitively.
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true,
+	"support": true, "help": true, "staff": true, "moderator": true, "official": true,
+	"ifeel": true, "api": true, "auth": true, "login": true, "logout": true,
+	"register": true, "signup": true, "settings": true, "search": true,
+	"me": true, "user": true, "users": true, "posts": true, "feed": true,
+	"follow": true, "followers": true, "following": true, "suggestions": true,
+	"blocks": true, "mutes": true,
+	"avatar": true, "emotion": true, "emotions": true,
+	"about": true, "terms": true, "privacy": true, "null": true, "undefined": true,
+}
+
+// FieldError describes why a single field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of field errors found in one request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator accumulates field errors. Each field reports at most one error,
+// the first rule it fails.
+type Validator struct {
+	errs   Errors
+	failed map[string]bool
+}
+
+func New() *Validator {
+	return &Validator{failed: map[string]bool{}}
+}
+
+// Errors returns the collected errors, or nil when every rule passed.
+func (v *Validator) Errors() Errors {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Check records message for field unless ok is true or the field already failed.
+func (v *Validator) Check(ok bool, field, message string) {
+	if ok || v.failed[field] {
+		return
+	}
+	v.failed[field] = true
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// Length checks the length in characters, not bytes, since most content is Japanese.
+func (v *Validator) Length(field, value string, min, max int) {
+	n := utf8.RuneCountInString(strings.TrimSpace(value))
+	v.Check(n >= min, field, "must be at least "+strconv.Itoa(min)+" characters")
+	v.Check(n <= max, field, "must be at most "+strconv.Itoa(max)+" characters")
+}
+
+func (v *Validator) UUID(field, value string) {
+	_, err := uuid.Parse(value)
+	v.Check(err == nil, field, "must be a valid UUID")
+}
+
+func (v *Validator) Email(field, value string) {
+	addr, err := mail.ParseAddress(value)
+	v.Check(err == nil && addr.Address == value, field, "must be a valid email address")
+}
+
+func (v *Validator) Username(field, value string) {
+	v.Check(usernamePattern.MatchString(value), field, "must be 3-30 letters, digits or underscores")
+	v.Check(!reservedUsernames[strings.ToLower(value)], field, "is reserved")
+}
+
+// Password requires a minimum length and at least one letter and one digit.
+func (v *Validator) Password(field, value string) {
+	var hasLetter, hasDigit bool
+	for _, r := range value {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	v.Check(len(value) >= MinPasswordLength, field, "must be at least "+strconv.Itoa(MinPasswordLength)+" characters")
+	v.Check(len(value) <= MaxPasswordLength, field, "must be at most "+strconv.Itoa(MaxPasswordLength)+" bytes")
+	v.Check(hasLetter && hasDigit, field, "must contain at least one letter and one digit")
+}
+
+// IntRange parses an integer query or path value and checks its bounds. It
+// returns def when value is empty and 0 when the value is invalid.
+func (v *Validator) IntRange(field, value string, min, max, def int) int {
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		v.Check(false, field, "must be an integer")
+		return 0
+	}
+	v.Check(n >= min && n <= max, field, "must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max))
+	return n
+}
+
+// Bool parses a boolean query value, defaulting to false when empty
+func (v *Validator) Bool(field, value string) bool {
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	v.Check(err == nil, field, "must be true or false")
+	return b
+}
+
+func (v *Validator) OneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.Check(false, field, "must be one of "+strings.Join(allowed, ", "))
+}
+
+func (v *Validator) ReactionType(field, value string) {
+	v.OneOf(field, value, ReactionTypes)
+}
+
+func (v *Validator) PostVisibility(field, value string) {
+	v.OneOf(field, value, PostVisibilities)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundWorkers runs jobs that outlive the request that started them,
+// such as topic similarity analysis, and lets shutdown wait for them.
+type backgroundWorkers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	stopping chan struct{} // closed when shutdown starts
+	stopOnce sync.Once
+}
+
+func newBackgroundWorkers() *backgroundWorkers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundWorkers{ctx: ctx, cancel: cancel, stopping: make(chan struct{})}
+}
+
+// Go runs fn in the background. fn receives a context that keeps the values
+// of reqCtx (request ID, logger) but is only cancelled when shutdown gives up
+// waiting, not when the request finishes.
+func (b *backgroundWorkers) Go(reqCtx context.Context, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(reqCtx))
+	stop := context.AfterFunc(b.ctx, cancel)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer stop()
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// Every runs fn every interval in the background until shutdown starts
+func (b *backgroundWorkers) Every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	b.Go(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn(ctx)
+			case <-b.stopping:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// Shutdown stops periodic jobs and waits for running jobs to finish. If ctx
+// expires first the jobs are cancelled and ctx's error is returned.
+func (b *backgroundWorkers) Shutdown(ctx context.Context) error {
+	b.stopOnce.Do(func() { close(b.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
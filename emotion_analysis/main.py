@@ -11,10 +11,14 @@ app = FastAPI()
 
 class PostAnalysisRequest(BaseModel):
     content: str
+    # 引用投稿の場合、引用元の投稿の本文
+    quoted: str = ""
 
 class ReplyAnalysisRequest(BaseModel):
     post: str
     reply: str
+    # 返信への返信の場合、投稿から直前の返信までの流れ（古い順）
+    parents: List[str] = []
 
 class TopicSimilarityRequest(BaseModel):
     post1: str
@@ -33,6 +37,7 @@ class TopicSimilarityResponse(BaseModel):
 
 post_analysis_prompt = ChatPromptTemplate.from_template("""
 あなたは感情分析AIです。以下の日本語の文章に含まれる感情を列挙してください。
+文章が他の投稿を引用している場合は、引用元の投稿を文脈として参考にしつつ、文章そのものに含まれる感情を列挙してください。
 それぞれの感情に 0〜1 のスコア（確信度）を付けてください。
 
 感情は以下の例ように英単語の小文字で表現してください。ただし、以下は例ですので、必ずしもこの中から選ぶ必要はありません。
@@ -40,6 +45,8 @@ post_analysis_prompt = ChatPromptTemplate.from_template("""
 - sadness
 - anger
 
+引用元の投稿（引用していない場合はなし）：
+{quoted}
 文章：
 "{text}"
 """)
@@ -55,16 +62,23 @@ reply_analysis_prompt = ChatPromptTemplate.from_template("""
 
 投稿：
 "{post}"
+返信の流れ（古い順。投稿への直接の返信の場合はなし）：
+{parents}
 返信：
 "{reply}"
 """)
 
+@app.get("/health")
+def health():
+    return {"status": "ok"}
+
 @app.post("/analyze_post")
 def analyze_emotion_of_post(data: PostAnalysisRequest):
     chain = post_analysis_prompt | llm.with_structured_output(EmotionAnalysisResponse)
 
     try:
-        result: EmotionAnalysisResponse = chain.invoke({"text": data.content})
+        quoted = f'"{data.quoted}"' if data.quoted else "なし"
+        result: EmotionAnalysisResponse = chain.invoke({"text": data.content, "quoted": quoted})
         print([{"emotion": item.emotion, "score": item.score} for item in result.emotions], flush=True)
         return [{"emotion": item.emotion, "score": item.score} for item in result.emotions]
     except Exception as e:
@@ -76,7 +90,8 @@ def analyze_emotion_of_reply(data: ReplyAnalysisRequest):
     chain = reply_analysis_prompt | llm.with_structured_output(EmotionAnalysisResponse)
 
     try:
-        result: EmotionAnalysisResponse = chain.invoke({"post": data.post, "reply": data.reply})
+        parents = "\n".join(f'"{p}"' for p in data.parents) or "なし"
+        result: EmotionAnalysisResponse = chain.invoke({"post": data.post, "parents": parents, "reply": data.reply})
         print([{"emotion": item.emotion, "score": item.score} for item in result.emotions], flush=True)
         return [{"emotion": item.emotion, "score": item.score} for item in result.emotions]
     except Exception as e:
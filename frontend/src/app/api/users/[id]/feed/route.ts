@@ -1,3 +1,4 @@
+import { cookies } from 'next/headers';
 import { NextRequest, NextResponse } from 'next/server';
 
 import { fetcher, createApiUrl } from '@/lib/fetcher';
@@ -8,8 +9,19 @@ export async function GET(
 ) {
   const userId = (await params).id; // ✅ 必要ならここで変数名だけ変更
 
+  // フィードは本人しか見られないので、ログイン中のトークンを転送する
+  const token = cookies().get('auth_token')?.value;
+  if (!token) {
+    return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+  }
+
   try {
-    const data = await fetcher(createApiUrl(`/users/${userId}/feed`));
+    const data = await fetcher(createApiUrl(`/users/${userId}/feed`), {
+      headers: {
+        'Content-Type': 'application/json',
+        Authorization: `Bearer ${token}`,
+      },
+    });
     return NextResponse.json(data);
   } catch (err: any) {
     console.error("Feed fetch error:", err);